@@ -44,6 +44,25 @@ type PlacementSpec struct {
 	// +optional
 	Downsync []ObjectTest `json:"downsync,omitempty"`
 
+	// `deletionPolicy` tells what happens to the objects delivered to a cluster when they
+	// stop being delivered there because of this Placement, e.g. when the Placement is
+	// deleted or no longer selects the object or the cluster: `Delete` (the default)
+	// deletes them from the cluster, `Orphan` leaves them there unmanaged.
+	// An object can override it with the `annotations.kubestellar.io/deletion-policy`
+	// annotation. When multiple Placement objects match the same workload object,
+	// `Orphan` rules.
+	// +optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// `applyOptions` tells how the work agents apply the objects delivered because of this
+	// Placement to the clusters. An object can override them with the
+	// `annotations.kubestellar.io/update-strategy`, `annotations.kubestellar.io/force-apply`
+	// and `annotations.kubestellar.io/field-manager` annotations. When multiple Placement
+	// objects match the same workload object, `CreateOnly` rules over `ServerSideApply`,
+	// which rules over `Update`.
+	// +optional
+	ApplyOptions *ApplyOptions `json:"applyOptions,omitempty"`
+
 	// WantSingletonReportedState indicates that (a) the number of selected locations is intended
 	// to be 1 and (b) the reported state of each downsynced object should be returned back to
 	// the object in this space.
@@ -58,10 +77,95 @@ type PlacementSpec struct {
 	Upsync []ObjectTest `json:"upsync,omitempty"`
 }
 
+// DeletionPolicy tells what happens to a delivered object when it is withdrawn from a cluster
+// +kubebuilder:validation:Enum=Delete;Orphan
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyDelete deletes the object from the cluster
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// DeletionPolicyOrphan leaves the object in the cluster, no longer managed
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+)
+
+// UpdateStrategyType tells how a work agent updates a delivered object
+// +kubebuilder:validation:Enum=Update;CreateOnly;ServerSideApply
+type UpdateStrategyType string
+
+const (
+	// UpdateStrategyUpdate updates the object with an update call, the default
+	UpdateStrategyUpdate UpdateStrategyType = "Update"
+	// UpdateStrategyCreateOnly creates the object and never updates it, e.g. for objects
+	// that are modified in the cluster afterwards
+	UpdateStrategyCreateOnly UpdateStrategyType = "CreateOnly"
+	// UpdateStrategyServerSideApply updates the object with server-side apply, leaving the
+	// fields managed by others in the cluster
+	UpdateStrategyServerSideApply UpdateStrategyType = "ServerSideApply"
+)
+
+// ApplyOptions tells how the work agents apply delivered objects to the clusters
+type ApplyOptions struct {
+	// `updateStrategy` is one of `Update` (the default), `CreateOnly` and `ServerSideApply`.
+	// +optional
+	UpdateStrategy UpdateStrategyType `json:"updateStrategy,omitempty"`
+
+	// `force` makes server-side apply take over the fields managed by others in case of
+	// conflicts. It is honored only with the `ServerSideApply` update strategy.
+	// +optional
+	Force bool `json:"force,omitempty"`
+
+	// `fieldManager` is the field manager of server-side apply, `work-agent` by default.
+	// It must start with `work-agent`. It is honored only with the `ServerSideApply`
+	// update strategy.
+	// +kubebuilder:validation:Pattern=`^work-agent`
+	// +optional
+	FieldManager string `json:"fieldManager,omitempty"`
+}
+
 // PlacementStatus defines the observed state of Placement
 type PlacementStatus struct {
 	Conditions         []PlacementCondition `json:"conditions"`
 	ObservedGeneration int64                `json:"observedGeneration"`
+
+	// `clusterHealth` reports, for each cluster where objects selected by this Placement
+	// have been delivered, the health of those objects as assessed from their reported status.
+	// +optional
+	ClusterHealth []ClusterHealth `json:"clusterHealth,omitempty"`
+}
+
+// HealthStatus is the assessed health of a delivered object, or of a set of delivered objects
+type HealthStatus string
+
+const (
+	// HealthHealthy means the object is running as intended
+	HealthHealthy HealthStatus = "Healthy"
+	// HealthProgressing means the object is not yet healthy but is still converging,
+	// e.g. a Deployment in the middle of a rollout
+	HealthProgressing HealthStatus = "Progressing"
+	// HealthDegraded means the object failed or cannot reach the desired state
+	HealthDegraded HealthStatus = "Degraded"
+	// HealthUnknown means the health of the object could not be assessed
+	HealthUnknown HealthStatus = "Unknown"
+)
+
+// ClusterHealth summarizes the health of the objects delivered by a Placement to a cluster.
+type ClusterHealth struct {
+	// `cluster` is the name of the ManagedCluster
+	Cluster string `json:"cluster"`
+
+	// `health` is the worst health among the objects delivered to the cluster,
+	// not counting objects whose health is unknown
+	Health HealthStatus `json:"health"`
+
+	// number of objects found in each health state
+	Healthy     int32 `json:"healthy"`
+	Progressing int32 `json:"progressing"`
+	Degraded    int32 `json:"degraded"`
+	Unknown     int32 `json:"unknown"`
+
+	// `message` describes the first object that is not healthy, if any
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // Placement is the Schema for the placementpolicies API
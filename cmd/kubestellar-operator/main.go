@@ -21,10 +21,15 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -32,7 +37,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	v1alpha1 "github.com/kubestellar/kubestellar/api/edge/v1alpha1"
+	"github.com/kubestellar/kubestellar/pkg/informers"
 	"github.com/kubestellar/kubestellar/pkg/placement"
+	"github.com/kubestellar/kubestellar/pkg/shard"
 	"github.com/kubestellar/kubestellar/pkg/status"
 	"github.com/kubestellar/kubestellar/pkg/util"
 )
@@ -45,6 +52,8 @@ var (
 const (
 	// number of workers to run the reconciliation loop
 	workers = 4
+	// namespace of the pod, when running in a cluster
+	inClusterNamespacePath = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
 )
 
 func init() {
@@ -60,10 +69,73 @@ func main() {
 	var probeAddr string
 	var wdsName string
 	var wdsLabel string
+	var excludeResources string
+	var includeResources string
+	var objectCacheSize int
+	var droppedFields string
+	var discoveryPeriod time.Duration
+	deliveryLimits := placement.DefaultDeliveryLimits()
+	var shards int
+	var maxShards int
+	var shardReplicas int
+	var shardLeaseNamespace string
+	var objectFinalizer bool
+	gcOptions := placement.DefaultGCOptions()
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.StringVar(&wdsName, "wds-name", "", "name of the workload description space to connect to")
 	flag.StringVar(&wdsLabel, "wds-label", "", "label of the workload description space to connect to")
+	flag.StringVar(&excludeResources, "exclude-resources", strings.Join(placement.DefaultExcludedResources, ","),
+		"comma separated list of API resources not watched by the placement controller, "+
+			"in the form <resource>[.<group>][/<version>]; <resource> can be * for all resources in the group")
+	flag.StringVar(&includeResources, "include-resources", "",
+		"comma separated list of API resources, in the same form as --exclude-resources, "+
+			"that are watched even if matched by an exclusion")
+	flag.IntVar(&objectCacheSize, "object-cache-size", informers.DefaultObjectCacheSize,
+		"number of full objects cached for delivery, as the informers for matching only cache metadata")
+	flag.StringVar(&droppedFields, "dropped-fields", strings.Join(informers.DefaultDroppedFields, ","),
+		"comma separated list of fields dropped from the objects cached by the placement controller, "+
+			"in the form metadata.managedFields or metadata.annotations[<key>]")
+	flag.DurationVar(&discoveryPeriod, "api-discovery-period", placement.DefaultDiscoveryPeriod,
+		"period of the API discovery by the placement controller, which picks up APIs served by "+
+			"aggregated API services and retries the groups whose discovery failed")
+	flag.Float64Var(&deliveryLimits.QPS, "delivery-qps", deliveryLimits.QPS,
+		"maximum rate of ManifestWork writes to the IMBS; not positive for no limit")
+	flag.IntVar(&deliveryLimits.Burst, "delivery-burst", deliveryLimits.Burst,
+		"maximum burst of ManifestWork writes to the IMBS")
+	flag.Float64Var(&deliveryLimits.ClusterQPS, "cluster-delivery-qps", deliveryLimits.ClusterQPS,
+		"maximum rate of ManifestWork writes to the mailbox of a cluster; not positive for no limit")
+	flag.IntVar(&deliveryLimits.ClusterBurst, "cluster-delivery-burst", deliveryLimits.ClusterBurst,
+		"maximum burst of ManifestWork writes to the mailbox of a cluster")
+	flag.Float64Var(&deliveryLimits.PlacementQPS, "placement-delivery-qps", deliveryLimits.PlacementQPS,
+		"maximum rate of ManifestWork writes on behalf of a placement; not positive for no limit")
+	flag.IntVar(&deliveryLimits.PlacementBurst, "placement-delivery-burst", deliveryLimits.PlacementBurst,
+		"maximum burst of ManifestWork writes on behalf of a placement")
+	flag.IntVar(&shards, "shards", 1,
+		"number of shards the objects of the WDS are split into across the replicas of the placement "+
+			"controller; with more than one shard, replicas claim shards with Leases instead of leader election, "+
+			"and --leader-elect is required as the status controller runs in the replica elected leader")
+	flag.IntVar(&maxShards, "max-shards-per-replica", 0,
+		"maximum number of shards claimed by a replica of the placement controller; not positive for all "+
+			"the shards, so that a single replica can reconcile all the objects")
+	flag.IntVar(&shardReplicas, "shard-replicas", 0,
+		"expected number of replicas of the placement controller; if positive, a --max-shards-per-replica "+
+			"with which the replicas cannot claim all the shards is rejected")
+	flag.StringVar(&shardLeaseNamespace, "shard-lease-namespace", "",
+		"namespace of the Leases of the shards; defaults to the namespace of the pod")
+	flag.BoolVar(&objectFinalizer, "object-finalizer", false,
+		"add a finalizer to the objects delivered by the placement controller, so that their deletion "+
+			"is propagated to the clusters even if it happens while the controller is not running; the "+
+			"finalizer "+placement.ObjectFinalizer+" must be removed from the objects before uninstalling")
+	flag.DurationVar(&gcOptions.Period, "gc-period", gcOptions.Period,
+		"period of the garbage collection of orphaned ManifestWorks, which also runs when the placement "+
+			"controller starts; not positive to only run it at start")
+	flag.BoolVar(&gcOptions.ReportOnly, "gc-report-only", gcOptions.ReportOnly,
+		"only log and count the orphaned ManifestWorks found by the garbage collection")
+	flag.Float64Var(&gcOptions.QPS, "gc-qps", gcOptions.QPS,
+		"maximum rate of deletions and updates of orphaned ManifestWorks; not positive for no limit")
+	flag.IntVar(&gcOptions.Burst, "gc-burst", gcOptions.Burst,
+		"maximum burst of deletions and updates of orphaned ManifestWorks")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -76,8 +148,16 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	// the status controller is not sharded, without leader election it would run in
+	// every replica and the replicas would race on the status updates
+	if shards > 1 && !enableLeaderElection {
+		setupLog.Error(nil, "--shards greater than 1 requires --leader-elect")
+		os.Exit(1)
+	}
+
 	// setup manager
-	// manager here is mainly used for leader election and health checks
+	// the manager runs the controllers in the replica elected leader, and serves
+	// health checks and metrics
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
@@ -128,32 +208,80 @@ func main() {
 	}
 	setupLog.Info("Got config for IMBS", "name", imbsName)
 
-	// start the placement controller
-	placementController, err := placement.NewController(mgr, wdsRestConfig, imbsRestConfig, wdsName)
+	resourceFilter, err := placement.NewResourceFilter(splitList(excludeResources), splitList(includeResources))
 	if err != nil {
-		setupLog.Error(err, "unable to create placement controller")
+		setupLog.Error(err, "invalid resource exclusion rules")
 		os.Exit(1)
 	}
 
-	if err := placementController.Start(workers); err != nil {
-		setupLog.Error(err, "error starting the placement controller")
-		os.Exit(1)
-	}
+	// when the status add-on is not present, the status is returned by the OCM
+	// work agent as feedback in the ManifestWorks
+	useWorkStatus := util.CheckWorkStatusIPresent(imbsRestConfig)
 
-	// check if status add-on present and if yes start the status controller
-	if util.CheckWorkStatusIPresent(imbsRestConfig) {
-		listers := placementController.GetListers()
-		informers := placementController.GetInformers()
-		statusController, err := status.NewController(mgr, wdsRestConfig, imbsRestConfig, wdsName, listers, informers)
+	// with sharding, the replicas split the objects of the WDS
+	var sharder placement.Sharder
+	if shards > 1 {
+		claimer, err := newShardClaimer(mgr, wdsName, shards, maxShards, shardReplicas, shardLeaseNamespace)
 		if err != nil {
-			setupLog.Error(err, "unable to create status controller")
+			setupLog.Error(err, "unable to set up sharding")
 			os.Exit(1)
 		}
-
-		if err := statusController.Start(workers); err != nil {
-			setupLog.Error(err, "error starting the status controller")
+		if err := mgr.Add(claimer); err != nil {
+			setupLog.Error(err, "unable to add the shard claimer to the manager")
 			os.Exit(1)
 		}
+		sharder = claimer
+	}
+
+	// create the placement controller
+	placementController, err := placement.NewController(mgr, wdsRestConfig, imbsRestConfig, wdsName,
+		placement.Options{
+			StatusFeedback:  !useWorkStatus,
+			ResourceFilter:  resourceFilter,
+			ObjectCacheSize: objectCacheSize,
+			DroppedFields:   splitList(droppedFields),
+			DiscoveryPeriod: discoveryPeriod,
+			DeliveryLimits:  &deliveryLimits,
+			Sharder:         sharder,
+			Workers:         workers,
+			ObjectFinalizer: objectFinalizer,
+			GC:              &gcOptions,
+		})
+	if err != nil {
+		setupLog.Error(err, "unable to create placement controller")
+		os.Exit(1)
+	}
+
+	// the controllers are run by the manager, in the replica elected leader
+	if err := mgr.Add(placementController); err != nil {
+		setupLog.Error(err, "unable to add the placement controller to the manager")
+		os.Exit(1)
+	}
+
+	// create the status controller with the status source available
+	var statusSource status.Source
+	if useWorkStatus {
+		setupLog.Info("Status add-on present, using WorkStatus as status source")
+		statusSource, err = status.NewWorkStatusSource(imbsRestConfig, wdsName)
+	} else {
+		setupLog.Info("Status add-on not present, using ManifestWork status feedback as status source")
+		statusSource, err = status.NewManifestWorkSource(imbsRestConfig, wdsName)
+	}
+	if err != nil {
+		setupLog.Error(err, "unable to create status source")
+		os.Exit(1)
+	}
+
+	registry := placementController.GetInformerRegistry()
+	statusController, err := status.NewController(mgr, wdsRestConfig, imbsRestConfig, wdsName, registry, statusSource, workers)
+	if err != nil {
+		setupLog.Error(err, "unable to create status controller")
+		os.Exit(1)
+	}
+
+	if err := mgr.Add(statusController); err != nil {
+		setupLog.Error(err, "unable to add the status controller to the manager")
+		os.Exit(1)
 	}
 
 	setupLog.Info("starting manager")
@@ -162,3 +290,43 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// splits a comma separated list, ignoring empty elements
+func splitList(list string) []string {
+	out := []string{}
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// creates the claimer of the shards of the placement controller, with Leases in the
+// namespace of the pod unless specified
+func newShardClaimer(mgr ctrl.Manager, wdsName string, shards, maxShards, replicas int,
+	namespace string) (*shard.Claimer, error) {
+	if namespace == "" {
+		data, err := os.ReadFile(inClusterNamespacePath)
+		if err != nil {
+			return nil, fmt.Errorf("--shard-lease-namespace is required when not running in a cluster: %w", err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+	return shard.NewClaimer(client, mgr.GetLogger(), shard.Options{
+		Shards:      shards,
+		MaxShards:   maxShards,
+		Replicas:    replicas,
+		Namespace:   namespace,
+		LeasePrefix: "kubestellar-" + wdsName + "-shard",
+		Identity:    hostname + "_" + string(uuid.NewUUID()),
+	})
+}
@@ -7,12 +7,14 @@ require (
 	github.com/kubestellar/kubeflex v0.3.4-0.20231215133035-02f74c29b172
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/openshift/client-go v0.0.0-20231024221206-506d798bc61c
+	github.com/prometheus/client_golang v1.16.0
 	golang.org/x/time v0.3.0
 	k8s.io/api v0.28.2
 	k8s.io/apiextensions-apiserver v0.28.2
 	k8s.io/apimachinery v0.28.2
 	k8s.io/client-go v0.28.2
 	k8s.io/code-generator v0.28.2
+	k8s.io/utils v0.0.0-20230726121419-3b25d923346b
 	open-cluster-management.io/api v0.12.0
 	sigs.k8s.io/controller-runtime v0.15.0
 )
@@ -54,7 +56,6 @@ require (
 	github.com/onsi/gomega v1.29.0 // indirect
 	github.com/openshift/api v0.0.0-20231024112103-79b9cd5e6020 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	github.com/prometheus/client_golang v1.16.0 // indirect
 	github.com/prometheus/client_model v0.4.0 // indirect
 	github.com/prometheus/common v0.44.0 // indirect
 	github.com/prometheus/procfs v0.10.1 // indirect
@@ -81,7 +82,6 @@ require (
 	k8s.io/gengo v0.0.0-20230829151522-9cce18d56c01 // indirect
 	k8s.io/klog/v2 v2.110.1 // indirect
 	k8s.io/kube-openapi v0.0.0-20231010175941-2dd684a91f00 // indirect
-	k8s.io/utils v0.0.0-20230726121419-3b25d923346b // indirect
 	sigs.k8s.io/json v0.0.0-20221116044647-bc3834ca7abd // indirect
 	sigs.k8s.io/structured-merge-diff/v4 v4.4.1 // indirect
 	sigs.k8s.io/yaml v1.3.0 // indirect
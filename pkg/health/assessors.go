@@ -0,0 +1,222 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/kubestellar/kubestellar/api/edge/v1alpha1"
+)
+
+func healthy() Result {
+	return Result{Status: v1alpha1.HealthHealthy}
+}
+
+func progressing(format string, args ...any) Result {
+	return Result{Status: v1alpha1.HealthProgressing, Message: fmt.Sprintf(format, args...)}
+}
+
+func degraded(format string, args ...any) Result {
+	return Result{Status: v1alpha1.HealthDegraded, Message: fmt.Sprintf(format, args...)}
+}
+
+func unknown(format string, args ...any) Result {
+	return Result{Status: v1alpha1.HealthUnknown, Message: fmt.Sprintf(format, args...)}
+}
+
+// AssessDeployment checks that the rollout is complete and all the desired replicas are available
+func AssessDeployment(obj *unstructured.Unstructured, status map[string]interface{}) Result {
+	if len(status) == 0 {
+		return progressing("no status reported yet")
+	}
+	if c := findCondition(status, "Progressing"); c != nil && c.reason == "ProgressDeadlineExceeded" {
+		return degraded("progress deadline exceeded: %s", c.message)
+	}
+	replicas := specReplicas(obj, status)
+	updated := nestedInt(status, "updatedReplicas")
+	available := nestedInt(status, "availableReplicas")
+	current := nestedInt(status, "replicas")
+	if updated < replicas {
+		return progressing("%d of %d replicas updated", updated, replicas)
+	}
+	if current > updated {
+		return progressing("%d old replicas pending termination", current-updated)
+	}
+	if available < updated {
+		return progressing("%d of %d updated replicas available", available, updated)
+	}
+	return healthy()
+}
+
+// AssessStatefulSet checks that all the desired replicas are ready at the update revision
+func AssessStatefulSet(obj *unstructured.Unstructured, status map[string]interface{}) Result {
+	if len(status) == 0 {
+		return progressing("no status reported yet")
+	}
+	replicas := specReplicas(obj, status)
+	ready := nestedInt(status, "readyReplicas")
+	if ready < replicas {
+		return progressing("%d of %d replicas ready", ready, replicas)
+	}
+	current, _, _ := unstructured.NestedString(status, "currentRevision")
+	update, _, _ := unstructured.NestedString(status, "updateRevision")
+	if update != "" && current != update {
+		updated := nestedInt(status, "updatedReplicas")
+		return progressing("%d of %d replicas updated to revision %s", updated, replicas, update)
+	}
+	return healthy()
+}
+
+// AssessDaemonSet checks that the pods are updated and available on all the scheduled nodes
+func AssessDaemonSet(obj *unstructured.Unstructured, status map[string]interface{}) Result {
+	if len(status) == 0 {
+		return progressing("no status reported yet")
+	}
+	desired := nestedInt(status, "desiredNumberScheduled")
+	updated := nestedInt(status, "updatedNumberScheduled")
+	available := nestedInt(status, "numberAvailable")
+	if updated < desired {
+		return progressing("%d of %d pods updated", updated, desired)
+	}
+	if available < desired {
+		return progressing("%d of %d pods available", available, desired)
+	}
+	return healthy()
+}
+
+// AssessJob considers a Job healthy when complete and degraded when failed
+func AssessJob(obj *unstructured.Unstructured, status map[string]interface{}) Result {
+	if c := findCondition(status, "Failed"); c != nil && c.status == "True" {
+		return degraded("job failed: %s", c.message)
+	}
+	if c := findCondition(status, "Complete"); c != nil && c.status == "True" {
+		return healthy()
+	}
+	if c := findCondition(status, "Suspended"); c != nil && c.status == "True" {
+		return progressing("job suspended")
+	}
+	return progressing("job running, %d active pods", nestedInt(status, "active"))
+}
+
+// AssessService checks that services of type LoadBalancer have been assigned an ingress point.
+// Other types of services are healthy as soon as they exist.
+func AssessService(obj *unstructured.Unstructured, status map[string]interface{}) Result {
+	if obj == nil {
+		return unknown("service spec not available")
+	}
+	serviceType, _, _ := unstructured.NestedString(obj.Object, "spec", "type")
+	if serviceType != "LoadBalancer" {
+		return healthy()
+	}
+	ingress, _, _ := unstructured.NestedSlice(status, "loadBalancer", "ingress")
+	if len(ingress) == 0 {
+		return progressing("waiting for load balancer ingress")
+	}
+	return healthy()
+}
+
+// AssessPersistentVolumeClaim checks that the claim is bound
+func AssessPersistentVolumeClaim(obj *unstructured.Unstructured, status map[string]interface{}) Result {
+	phase, _, _ := unstructured.NestedString(status, "phase")
+	switch phase {
+	case "Bound":
+		return healthy()
+	case "Lost":
+		return degraded("claim lost its volume")
+	case "":
+		return progressing("no status reported yet")
+	}
+	return progressing("claim is %s", phase)
+}
+
+// AssessReadyCondition evaluates objects, typically custom resources, that follow the
+// convention of reporting a `Ready` condition. Objects without it have unknown health.
+func AssessReadyCondition(obj *unstructured.Unstructured, status map[string]interface{}) Result {
+	c := findCondition(status, "Ready")
+	if c == nil {
+		return unknown("no Ready condition")
+	}
+	switch c.status {
+	case "True":
+		return healthy()
+	case "False":
+		return degraded("%s: %s", c.reason, c.message)
+	}
+	return progressing("%s: %s", c.reason, c.message)
+}
+
+type condition struct {
+	status  string
+	reason  string
+	message string
+}
+
+func findCondition(status map[string]interface{}, conditionType string) *condition {
+	conditions, _, _ := unstructured.NestedSlice(status, "conditions")
+	for _, c := range conditions {
+		cMap, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if t, _ := cMap["type"].(string); t != conditionType {
+			continue
+		}
+		s, _ := cMap["status"].(string)
+		r, _ := cMap["reason"].(string)
+		m, _ := cMap["message"].(string)
+		return &condition{status: s, reason: r, message: m}
+	}
+	return nil
+}
+
+// replicas from the spec of the object in the WDS, falling back to the reported
+// number of replicas if the object is not available. Defaults to 1 as the API does.
+func specReplicas(obj *unstructured.Unstructured, status map[string]interface{}) int64 {
+	if obj == nil {
+		return nestedInt(status, "replicas")
+	}
+	replicas, found, err := unstructured.NestedFieldNoCopy(obj.Object, "spec", "replicas")
+	if !found || err != nil {
+		return 1
+	}
+	return toInt(replicas)
+}
+
+// numbers may be decoded as int64 or float64 depending on how the status was unmarshalled
+func nestedInt(obj map[string]interface{}, fields ...string) int64 {
+	val, found, err := unstructured.NestedFieldNoCopy(obj, fields...)
+	if !found || err != nil {
+		return 0
+	}
+	return toInt(val)
+}
+
+func toInt(val interface{}) int64 {
+	switch v := val.(type) {
+	case int64:
+		return v
+	case int32:
+		return int64(v)
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
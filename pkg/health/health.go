@@ -0,0 +1,144 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/kubestellar/kubestellar/api/edge/v1alpha1"
+)
+
+// Result is the outcome of a health assessment
+type Result struct {
+	Status  v1alpha1.HealthStatus
+	Message string
+}
+
+// Assessor evaluates the health of an object from the status reported by the cluster
+// where the object runs. The object in the WDS is passed to access the desired state
+// (e.g. the number of replicas); it may be nil if the object is not available.
+type Assessor func(obj *unstructured.Unstructured, status map[string]interface{}) Result
+
+var (
+	lock      sync.RWMutex
+	assessors = map[schema.GroupKind]Assessor{
+		{Group: "apps", Kind: "Deployment"}:        AssessDeployment,
+		{Group: "apps", Kind: "StatefulSet"}:       AssessStatefulSet,
+		{Group: "apps", Kind: "DaemonSet"}:         AssessDaemonSet,
+		{Group: "batch", Kind: "Job"}:              AssessJob,
+		{Group: "", Kind: "Service"}:               AssessService,
+		{Group: "", Kind: "PersistentVolumeClaim"}: AssessPersistentVolumeClaim,
+	}
+	// kinds whose assessor reads the desired state from the object in the WDS
+	needsObject = map[schema.GroupKind]bool{
+		{Group: "apps", Kind: "Deployment"}:  true,
+		{Group: "apps", Kind: "StatefulSet"}: true,
+		{Group: "", Kind: "Service"}:         true,
+	}
+)
+
+// Register sets the assessor for a group/kind, replacing any existing one.
+// Kinds without a registered assessor are evaluated with AssessReadyCondition.
+// Registered assessors are passed the object in the WDS.
+func Register(gk schema.GroupKind, assessor Assessor) {
+	lock.Lock()
+	defer lock.Unlock()
+	assessors[gk] = assessor
+	needsObject[gk] = true
+}
+
+// NeedsObject returns true if the assessor of the group/kind reads the object in the WDS.
+// For the other kinds the object need not be fetched, and nil can be passed to Assess.
+func NeedsObject(gk schema.GroupKind) bool {
+	lock.RLock()
+	defer lock.RUnlock()
+	return needsObject[gk]
+}
+
+// Assess evaluates the health of an object of the given group/kind from its reported status
+func Assess(gk schema.GroupKind, obj *unstructured.Unstructured, status map[string]interface{}) Result {
+	lock.RLock()
+	assessor, ok := assessors[gk]
+	lock.RUnlock()
+	if !ok {
+		assessor = AssessReadyCondition
+	}
+	return assessor(obj, status)
+}
+
+// Summary accumulates the health of a set of objects
+type Summary struct {
+	Healthy     int32
+	Progressing int32
+	Degraded    int32
+	Unknown     int32
+	// Message of the first object found in the worst state
+	Message string
+}
+
+// Add accounts for the result of the assessment of the object identified by name
+func (s *Summary) Add(name string, r Result) {
+	worse := severity(r.Status) > severity(s.Status())
+	switch r.Status {
+	case v1alpha1.HealthHealthy:
+		s.Healthy++
+	case v1alpha1.HealthProgressing:
+		s.Progressing++
+	case v1alpha1.HealthDegraded:
+		s.Degraded++
+	default:
+		s.Unknown++
+	}
+	if severity(r.Status) > severity(v1alpha1.HealthHealthy) && (worse || s.Message == "") {
+		s.Message = fmt.Sprintf("%s: %s", name, r.Message)
+	}
+}
+
+// Status returns the worst status among the objects accounted for. Objects whose health
+// is unknown do not contribute, unless there are no other objects.
+func (s *Summary) Status() v1alpha1.HealthStatus {
+	switch {
+	case s.Degraded > 0:
+		return v1alpha1.HealthDegraded
+	case s.Progressing > 0:
+		return v1alpha1.HealthProgressing
+	case s.Healthy > 0:
+		return v1alpha1.HealthHealthy
+	}
+	return v1alpha1.HealthUnknown
+}
+
+// Total returns the number of objects accounted for
+func (s *Summary) Total() int32 {
+	return s.Healthy + s.Progressing + s.Degraded + s.Unknown
+}
+
+func severity(status v1alpha1.HealthStatus) int {
+	switch status {
+	case v1alpha1.HealthHealthy:
+		return 1
+	case v1alpha1.HealthProgressing:
+		return 2
+	case v1alpha1.HealthDegraded:
+		return 3
+	}
+	return 0
+}
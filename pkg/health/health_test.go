@@ -0,0 +1,158 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/kubestellar/kubestellar/api/edge/v1alpha1"
+)
+
+func TestAssess(t *testing.T) {
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"replicas": int64(3)},
+	}}
+	lbService := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"type": "LoadBalancer"},
+	}}
+
+	tests := []struct {
+		name     string
+		gk       schema.GroupKind
+		obj      *unstructured.Unstructured
+		status   map[string]interface{}
+		expected v1alpha1.HealthStatus
+	}{
+		{
+			name: "deployment available",
+			gk:   schema.GroupKind{Group: "apps", Kind: "Deployment"},
+			obj:  deployment,
+			status: map[string]interface{}{
+				"replicas": int64(3), "updatedReplicas": int64(3), "availableReplicas": int64(3)},
+			expected: v1alpha1.HealthHealthy,
+		},
+		{
+			name: "deployment rolling out",
+			gk:   schema.GroupKind{Group: "apps", Kind: "Deployment"},
+			obj:  deployment,
+			status: map[string]interface{}{
+				"replicas": float64(3), "updatedReplicas": float64(1), "availableReplicas": float64(3)},
+			expected: v1alpha1.HealthProgressing,
+		},
+		{
+			name: "deployment past progress deadline",
+			gk:   schema.GroupKind{Group: "apps", Kind: "Deployment"},
+			obj:  deployment,
+			status: map[string]interface{}{
+				"conditions": []interface{}{map[string]interface{}{
+					"type": "Progressing", "status": "False", "reason": "ProgressDeadlineExceeded"}}},
+			expected: v1alpha1.HealthDegraded,
+		},
+		{
+			name:     "statefulset not ready",
+			gk:       schema.GroupKind{Group: "apps", Kind: "StatefulSet"},
+			obj:      deployment,
+			status:   map[string]interface{}{"readyReplicas": int64(2)},
+			expected: v1alpha1.HealthProgressing,
+		},
+		{
+			name: "daemonset available",
+			gk:   schema.GroupKind{Group: "apps", Kind: "DaemonSet"},
+			status: map[string]interface{}{
+				"desiredNumberScheduled": int64(2), "updatedNumberScheduled": int64(2), "numberAvailable": int64(2)},
+			expected: v1alpha1.HealthHealthy,
+		},
+		{
+			name: "job failed",
+			gk:   schema.GroupKind{Group: "batch", Kind: "Job"},
+			status: map[string]interface{}{
+				"conditions": []interface{}{map[string]interface{}{"type": "Failed", "status": "True"}}},
+			expected: v1alpha1.HealthDegraded,
+		},
+		{
+			name:     "load balancer without ingress",
+			gk:       schema.GroupKind{Kind: "Service"},
+			obj:      lbService,
+			status:   map[string]interface{}{"loadBalancer": map[string]interface{}{}},
+			expected: v1alpha1.HealthProgressing,
+		},
+		{
+			name:     "pvc bound",
+			gk:       schema.GroupKind{Kind: "PersistentVolumeClaim"},
+			status:   map[string]interface{}{"phase": "Bound"},
+			expected: v1alpha1.HealthHealthy,
+		},
+		{
+			name: "custom resource not ready",
+			gk:   schema.GroupKind{Group: "example.com", Kind: "Widget"},
+			status: map[string]interface{}{
+				"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": "False"}}},
+			expected: v1alpha1.HealthDegraded,
+		},
+		{
+			name:     "custom resource without conditions",
+			gk:       schema.GroupKind{Group: "example.com", Kind: "Widget"},
+			status:   map[string]interface{}{},
+			expected: v1alpha1.HealthUnknown,
+		},
+	}
+
+	for _, test := range tests {
+		result := Assess(test.gk, test.obj, test.status)
+		if result.Status != test.expected {
+			t.Errorf("%s: expected %s, got %s (%s)", test.name, test.expected, result.Status, result.Message)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	s := Summary{}
+	s.Add("a", Result{Status: v1alpha1.HealthHealthy})
+	s.Add("b", Result{Status: v1alpha1.HealthUnknown})
+	if s.Status() != v1alpha1.HealthHealthy {
+		t.Errorf("expected Healthy, got %s", s.Status())
+	}
+	s.Add("c", Result{Status: v1alpha1.HealthProgressing, Message: "rolling out"})
+	s.Add("d", Result{Status: v1alpha1.HealthDegraded, Message: "failed"})
+	s.Add("e", Result{Status: v1alpha1.HealthProgressing, Message: "rolling out"})
+	if s.Status() != v1alpha1.HealthDegraded {
+		t.Errorf("expected Degraded, got %s", s.Status())
+	}
+	if s.Message != "d: failed" {
+		t.Errorf("expected message of the first degraded object, got %q", s.Message)
+	}
+	if s.Total() != 5 {
+		t.Errorf("expected 5 objects, got %d", s.Total())
+	}
+}
+
+func TestNeedsObject(t *testing.T) {
+	for gk, expected := range map[schema.GroupKind]bool{
+		{Group: "apps", Kind: "Deployment"}:        true,
+		{Group: "", Kind: "Service"}:               true,
+		{Group: "apps", Kind: "DaemonSet"}:         false,
+		{Group: "", Kind: "PersistentVolumeClaim"}: false,
+		{Group: "example.com", Kind: "Widget"}:     false,
+	} {
+		if NeedsObject(gk) != expected {
+			t.Errorf("expected NeedsObject(%v) to be %v", gk, expected)
+		}
+	}
+}
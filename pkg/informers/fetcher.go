@@ -0,0 +1,84 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package informers
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/utils/lru"
+)
+
+// DefaultObjectCacheSize is the default number of full objects kept by an ObjectFetcher
+const DefaultObjectCacheSize = 256
+
+// ObjectFetcher retrieves the full objects for kinds whose informers only cache metadata.
+// Recently fetched objects are kept in a small LRU cache and are returned as long as their
+// resourceVersion matches the one in the metadata cache.
+type ObjectFetcher struct {
+	client dynamic.Interface
+	cache  *lru.Cache
+}
+
+type objectCacheKey struct {
+	gvr       schema.GroupVersionResource
+	namespace string
+	name      string
+}
+
+// NewObjectFetcher creates a fetcher keeping up to size objects in its cache.
+// If size is not positive, DefaultObjectCacheSize is used.
+func NewObjectFetcher(client dynamic.Interface, size int) *ObjectFetcher {
+	if size <= 0 {
+		size = DefaultObjectCacheSize
+	}
+	return &ObjectFetcher{
+		client: client,
+		cache:  lru.New(size),
+	}
+}
+
+// Get returns a copy of the object, from the cache if the cached copy has the given
+// resourceVersion, otherwise from the API server. An empty resourceVersion always
+// fetches from the API server.
+func (f *ObjectFetcher) Get(ctx context.Context, gvr schema.GroupVersionResource,
+	namespace, name, resourceVersion string) (*unstructured.Unstructured, error) {
+	key := objectCacheKey{gvr: gvr, namespace: namespace, name: name}
+	if resourceVersion != "" {
+		if cached, ok := f.cache.Get(key); ok {
+			obj := cached.(*unstructured.Unstructured)
+			if obj.GetResourceVersion() == resourceVersion {
+				return obj.DeepCopy(), nil
+			}
+		}
+	}
+
+	var resource dynamic.ResourceInterface = f.client.Resource(gvr)
+	if namespace != "" {
+		resource = f.client.Resource(gvr).Namespace(namespace)
+	}
+	obj, err := resource.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		f.cache.Remove(key)
+		return nil, err
+	}
+	f.cache.Add(key, obj)
+	return obj.DeepCopy(), nil
+}
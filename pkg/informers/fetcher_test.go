@@ -0,0 +1,73 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package informers
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestObjectFetcher(t *testing.T) {
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	cm := &unstructured.Unstructured{}
+	cm.SetAPIVersion("v1")
+	cm.SetKind("ConfigMap")
+	cm.SetNamespace("ns")
+	cm.SetName("cm")
+	cm.SetResourceVersion("1")
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "ConfigMapList"}, cm)
+	gets := 0
+	client.PrependReactor("get", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		gets++
+		return false, nil, nil
+	})
+
+	fetcher := NewObjectFetcher(client, 0)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		obj, err := fetcher.Get(ctx, gvr, "ns", "cm", "1")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if obj.GetName() != "cm" {
+			t.Errorf("expected object cm, got %s", obj.GetName())
+		}
+	}
+	if gets != 1 {
+		t.Errorf("expected 1 get for an unchanged object, got %d", gets)
+	}
+
+	// a different resourceVersion in the metadata cache forces a new get
+	if _, err := fetcher.Get(ctx, gvr, "ns", "cm", "2"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if gets != 2 {
+		t.Errorf("expected 2 gets after the resourceVersion changed, got %d", gets)
+	}
+
+	if _, err := fetcher.Get(ctx, gvr, "ns", "missing", "1"); err == nil {
+		t.Errorf("expected error for missing object")
+	}
+}
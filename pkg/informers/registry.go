@@ -0,0 +1,311 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package informers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Registry is a thread-safe store of the dynamic informers and listers for the
+// API resources of a WDS. Informers are keyed by the group/version/Kind key
+// produced by util.KeyForGroupVersionKind. The placement controller adds and
+// removes entries as API resources appear and disappear, other controllers
+// (e.g. the status controller) share the same caches and subscribe to be
+// notified of changes in the set of available kinds.
+// The registry owns the lifecycle of the informers: an informer runs from when it
+// is added until it is removed or replaced, or the registry is stopped.
+// Informers for most kinds only cache metadata; use GetObject to retrieve the full objects.
+type Registry struct {
+	lock        sync.RWMutex
+	entries     map[string]*entry
+	subscribers []Subscriber
+	fetcher     *ObjectFetcher
+	stopped     bool
+	// tracks the goroutines running the informers
+	running sync.WaitGroup
+}
+
+const syncPollPeriod = 100 * time.Millisecond
+
+var errRegistryStopped = errors.New("informer registry stopped")
+
+type entry struct {
+	gvr          schema.GroupVersionResource
+	informer     cache.SharedIndexInformer
+	lister       cache.GenericLister
+	metadataOnly bool
+	stopCh       chan struct{}
+}
+
+// Subscriber is notified when kinds are added to or removed from the registry.
+// Notifications are delivered synchronously, so the functions should not block.
+type Subscriber struct {
+	AddFunc    func(key string)
+	RemoveFunc func(key string)
+}
+
+// NewRegistry creates an empty registry. The fetcher is used to retrieve the full
+// objects of kinds whose informers only cache metadata.
+func NewRegistry(fetcher *ObjectFetcher) *Registry {
+	return &Registry{
+		entries: make(map[string]*entry),
+		fetcher: fetcher,
+	}
+}
+
+// Add registers the informer for the given key, creates a lister for it and runs it.
+// The event handlers must be added to the informer before it is registered.
+// If an informer is already registered for the key it is stopped and replaced.
+// Subscribers are notified after the entry has been added.
+// Informers added after the registry has been stopped are not run.
+func (r *Registry) Add(key string, gvr schema.GroupVersionResource, informer cache.SharedIndexInformer) {
+	r.add(key, gvr, informer, false)
+}
+
+// AddMetadataOnly is like Add, for an informer caching *metav1.PartialObjectMetadata
+func (r *Registry) AddMetadataOnly(key string, gvr schema.GroupVersionResource, informer cache.SharedIndexInformer) {
+	r.add(key, gvr, informer, true)
+}
+
+func (r *Registry) add(key string, gvr schema.GroupVersionResource, informer cache.SharedIndexInformer, metadataOnly bool) {
+	e := &entry{
+		gvr:          gvr,
+		informer:     informer,
+		lister:       cache.NewGenericLister(informer.GetIndexer(), gvr.GroupResource()),
+		metadataOnly: metadataOnly,
+		stopCh:       make(chan struct{}),
+	}
+
+	r.lock.Lock()
+	if r.stopped {
+		r.lock.Unlock()
+		return
+	}
+	if old, ok := r.entries[key]; ok {
+		close(old.stopCh)
+	}
+	r.entries[key] = e
+	r.running.Add(1)
+	go func() {
+		defer r.running.Done()
+		informer.Run(e.stopCh)
+	}()
+	subscribers := r.copySubscribers()
+	r.lock.Unlock()
+
+	for _, s := range subscribers {
+		if s.AddFunc != nil {
+			s.AddFunc(key)
+		}
+	}
+}
+
+// Remove stops the informer for the given key and deletes its entry, if present,
+// then notifies subscribers. Entries are kept once the registry is stopped.
+func (r *Registry) Remove(key string) {
+	r.lock.Lock()
+	if r.stopped {
+		r.lock.Unlock()
+		return
+	}
+	e, found := r.entries[key]
+	if found {
+		close(e.stopCh)
+		delete(r.entries, key)
+	}
+	subscribers := r.copySubscribers()
+	r.lock.Unlock()
+
+	if !found {
+		return
+	}
+	for _, s := range subscribers {
+		if s.RemoveFunc != nil {
+			s.RemoveFunc(key)
+		}
+	}
+}
+
+// Stop stops all the informers and waits for them to return. The entries are kept,
+// so that the listers can still be read, and subscribers are not notified.
+// Stop is idempotent.
+func (r *Registry) Stop() {
+	r.lock.Lock()
+	if !r.stopped {
+		r.stopped = true
+		for _, e := range r.entries {
+			close(e.stopCh)
+		}
+	}
+	r.lock.Unlock()
+	r.running.Wait()
+}
+
+// WaitForCacheSync waits for the caches of all the informers in the registry to sync.
+// Informers removed while waiting are not waited for. Returns false if the context
+// is done or the registry is stopped before the caches have synced.
+func (r *Registry) WaitForCacheSync(ctx context.Context) bool {
+	for _, key := range r.Keys() {
+		synced := func(context.Context) (bool, error) {
+			r.lock.RLock()
+			defer r.lock.RUnlock()
+			if r.stopped {
+				return false, errRegistryStopped
+			}
+			e, ok := r.entries[key]
+			return !ok || e.informer.HasSynced(), nil
+		}
+		if err := wait.PollUntilContextCancel(ctx, syncPollPeriod, true, synced); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Subscribe adds a subscriber. The AddFunc of the subscriber is invoked
+// for all the keys already in the registry, similarly to what happens
+// when adding an event handler to an informer.
+func (r *Registry) Subscribe(s Subscriber) {
+	r.lock.Lock()
+	r.subscribers = append(r.subscribers, s)
+	keys := r.sortedKeys()
+	r.lock.Unlock()
+
+	if s.AddFunc == nil {
+		return
+	}
+	for _, key := range keys {
+		s.AddFunc(key)
+	}
+}
+
+// GetLister returns the lister for the given key
+func (r *Registry) GetLister(key string) (cache.GenericLister, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	e, ok := r.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return e.lister, true
+}
+
+// GetObject returns the full object with the given namespace and name. The object must be
+// in the cache of the informer for the key; for metadata-only informers it is retrieved
+// with the fetcher at the resourceVersion found in the cache, or a later one.
+// Returns a NotFound error if the object is not in the cache.
+func (r *Registry) GetObject(ctx context.Context, key, namespace, name string) (runtime.Object, error) {
+	r.lock.RLock()
+	e, ok := r.entries[key]
+	r.lock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("could not find lister for key %s", key)
+	}
+
+	var obj runtime.Object
+	var err error
+	if namespace != "" {
+		obj, err = e.lister.ByNamespace(namespace).Get(name)
+	} else {
+		obj, err = e.lister.Get(name)
+	}
+	if err != nil || !e.metadataOnly {
+		return obj, err
+	}
+	if r.fetcher == nil {
+		return nil, fmt.Errorf("no fetcher for metadata-only informer with key %s", key)
+	}
+	mObj, ok := obj.(metav1.Object)
+	if !ok {
+		return nil, fmt.Errorf("object in the cache for key %s is not a metav1.Object", key)
+	}
+	return r.fetcher.Get(ctx, e.gvr, namespace, name, mObj.GetResourceVersion())
+}
+
+// GetInformer returns the informer for the given key
+func (r *Registry) GetInformer(key string) (cache.SharedIndexInformer, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	e, ok := r.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return e.informer, true
+}
+
+// GetGVR returns the GroupVersionResource for the given key
+func (r *Registry) GetGVR(key string) (schema.GroupVersionResource, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	e, ok := r.entries[key]
+	if !ok {
+		return schema.GroupVersionResource{}, false
+	}
+	return e.gvr, true
+}
+
+// HasSynced returns true if an informer is registered for the key and its cache has synced
+func (r *Registry) HasSynced(key string) bool {
+	informer, ok := r.GetInformer(key)
+	if !ok {
+		return false
+	}
+	return informer.HasSynced()
+}
+
+// Has returns true if an informer is registered for the key
+func (r *Registry) Has(key string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	_, ok := r.entries[key]
+	return ok
+}
+
+// Keys returns the sorted list of keys in the registry
+func (r *Registry) Keys() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.sortedKeys()
+}
+
+// must be called with the lock held
+func (r *Registry) sortedKeys() []string {
+	keys := make([]string, 0, len(r.entries))
+	for k := range r.entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// must be called with the lock held
+func (r *Registry) copySubscribers() []Subscriber {
+	subscribers := make([]Subscriber, len(r.subscribers))
+	copy(subscribers, r.subscribers)
+	return subscribers
+}
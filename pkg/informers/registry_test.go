@@ -0,0 +1,169 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package informers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+var testGVR = schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+
+// newTestInformer returns an informer listing no objects and watching nothing
+func newTestInformer() cache.SharedIndexInformer {
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return &unstructured.UnstructuredList{}, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return watch.NewFake(), nil
+		},
+	}
+	return cache.NewSharedIndexInformer(lw, &unstructured.Unstructured{}, 0, cache.Indexers{})
+}
+
+func waitForStop(t *testing.T, informer cache.SharedIndexInformer) {
+	t.Helper()
+	err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true,
+		func(context.Context) (bool, error) { return informer.IsStopped(), nil })
+	if err != nil {
+		t.Fatalf("informer was not stopped")
+	}
+}
+
+func TestRegistryLifecycle(t *testing.T) {
+	r := NewRegistry(nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	first := newTestInformer()
+	r.Add("a", testGVR, first)
+	if !r.WaitForCacheSync(ctx) {
+		t.Fatalf("expected caches to sync")
+	}
+
+	// replacing the informer stops the previous one
+	second := newTestInformer()
+	r.Add("a", testGVR, second)
+	waitForStop(t, first)
+	if informer, _ := r.GetInformer("a"); informer != second {
+		t.Errorf("expected the informer to be replaced")
+	}
+
+	r.Remove("a")
+	waitForStop(t, second)
+	if r.Has("a") {
+		t.Errorf("expected the entry to be removed")
+	}
+
+	third := newTestInformer()
+	r.Add("b", testGVR, third)
+	r.Stop()
+	if !third.IsStopped() {
+		t.Errorf("expected the informers to be stopped when the registry stops")
+	}
+	if r.WaitForCacheSync(ctx) {
+		t.Errorf("expected waiting for the caches of a stopped registry to fail")
+	}
+
+	// informers added after stopping are not run
+	r.Add("c", testGVR, newTestInformer())
+	if r.Has("c") {
+		t.Errorf("expected no entries to be added after stopping")
+	}
+	// removing the stopped informers does not close their stop channel again
+	r.Remove("b")
+	if !r.Has("b") {
+		t.Errorf("expected the entries to be kept after stopping")
+	}
+	r.Stop()
+}
+
+func TestRegistryWaitForRemovedInformer(t *testing.T) {
+	r := NewRegistry(nil)
+	defer r.Stop()
+
+	// the informer never syncs as listing fails
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return nil, fmt.Errorf("not available")
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return watch.NewFake(), nil
+		},
+	}
+	r.Add("a", testGVR, cache.NewSharedIndexInformer(lw, &unstructured.Unstructured{}, 0, cache.Indexers{}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		r.Remove("a")
+	}()
+	if !r.WaitForCacheSync(ctx) {
+		t.Errorf("expected waiting not to block on a removed informer")
+	}
+}
+
+// run with -race to detect unsynchronized access
+func TestRegistryConcurrentAccess(t *testing.T) {
+	r := NewRegistry(nil)
+	var notified sync.Map
+	r.Subscribe(Subscriber{
+		AddFunc:    func(key string) { notified.Store(key, true) },
+		RemoveFunc: func(key string) { notified.Delete(key) },
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				key := fmt.Sprintf("key-%d", j%5)
+				if (i+j)%2 == 0 {
+					r.Add(key, testGVR, newTestInformer())
+				} else {
+					r.Remove(key)
+				}
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				for _, key := range r.Keys() {
+					r.GetLister(key)
+					r.GetGVR(key)
+					r.HasSynced(key)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	r.Stop()
+}
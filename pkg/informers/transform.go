@@ -0,0 +1,124 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package informers
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DefaultDroppedFields are the fields dropped by default from the objects cached by informers,
+// as they are large and not used by the controllers
+var DefaultDroppedFields = []string{
+	"metadata.managedFields",
+	"metadata.annotations[kubectl.kubernetes.io/last-applied-configuration]",
+}
+
+// ParseFieldPath parses a path in the form `metadata.managedFields` or
+// `metadata.annotations[<key>]`, where keys in square brackets may contain dots
+func ParseFieldPath(path string) ([]string, error) {
+	fields := []string{}
+	rest := strings.TrimSpace(path)
+	if rest == "" {
+		return nil, fmt.Errorf("empty field path")
+	}
+	for rest != "" {
+		var field string
+		if strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("missing ']' in field path %q", path)
+			}
+			field, rest = rest[1:end], rest[end+1:]
+			rest = strings.TrimPrefix(rest, ".")
+		} else {
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			field, rest = rest[:end], rest[end:]
+			rest = strings.TrimPrefix(rest, ".")
+		}
+		if field == "" {
+			return nil, fmt.Errorf("empty field in field path %q", path)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// NewDropFieldsTransform returns a transform that drops the given fields, in the form
+// accepted by ParseFieldPath, from the objects before they are stored in an informer cache.
+// Any field can be dropped from unstructured objects, while only the managed fields and
+// annotations can be dropped from other objects, e.g. *metav1.PartialObjectMetadata.
+func NewDropFieldsTransform(paths []string) (cache.TransformFunc, error) {
+	fieldPaths := make([][]string, 0, len(paths))
+	for _, path := range paths {
+		fields, err := ParseFieldPath(path)
+		if err != nil {
+			return nil, err
+		}
+		fieldPaths = append(fieldPaths, fields)
+	}
+
+	return func(obj interface{}) (interface{}, error) {
+		switch o := obj.(type) {
+		case *unstructured.Unstructured:
+			for _, fields := range fieldPaths {
+				unstructured.RemoveNestedField(o.Object, fields...)
+			}
+		case metav1.Object:
+			for _, fields := range fieldPaths {
+				dropMetadataField(o, fields)
+			}
+		}
+		return obj, nil
+	}, nil
+}
+
+func dropMetadataField(obj metav1.Object, fields []string) {
+	if len(fields) < 2 || fields[0] != "metadata" {
+		return
+	}
+	switch {
+	case len(fields) == 2 && fields[1] == "managedFields":
+		obj.SetManagedFields(nil)
+	case len(fields) == 3 && fields[1] == "annotations":
+		annotations := obj.GetAnnotations()
+		if _, ok := annotations[fields[2]]; ok {
+			delete(annotations, fields[2])
+			obj.SetAnnotations(annotations)
+		}
+	}
+}
+
+// ChainTransforms returns a transform applying the given transforms in order
+func ChainTransforms(transforms ...cache.TransformFunc) cache.TransformFunc {
+	return func(obj interface{}) (interface{}, error) {
+		var err error
+		for _, transform := range transforms {
+			if obj, err = transform(obj); err != nil {
+				return nil, err
+			}
+		}
+		return obj, nil
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package informers
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const lastApplied = "kubectl.kubernetes.io/last-applied-configuration"
+
+func TestParseFieldPath(t *testing.T) {
+	tests := map[string][]string{
+		"metadata.managedFields":                    {"metadata", "managedFields"},
+		"metadata.annotations[" + lastApplied + "]": {"metadata", "annotations", lastApplied},
+		"status.conditions":                         {"status", "conditions"},
+	}
+	for path, expected := range tests {
+		fields, err := ParseFieldPath(path)
+		if err != nil {
+			t.Errorf("unexpected error parsing %q: %s", path, err)
+			continue
+		}
+		if !reflect.DeepEqual(fields, expected) {
+			t.Errorf("parsing %q: expected %v, got %v", path, expected, fields)
+		}
+	}
+
+	for _, path := range []string{"", "metadata..name", "metadata.annotations[key"} {
+		if _, err := ParseFieldPath(path); err == nil {
+			t.Errorf("expected error parsing %q", path)
+		}
+	}
+}
+
+func TestDropFieldsTransform(t *testing.T) {
+	transform, err := NewDropFieldsTransform(DefaultDroppedFields)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	annotations := map[string]string{lastApplied: "{}", "keep": "true"}
+	managedFields := []metav1.ManagedFieldsEntry{{Manager: "kubectl"}}
+
+	uObj := &unstructured.Unstructured{}
+	uObj.SetName("a")
+	uObj.SetAnnotations(annotations)
+	uObj.SetManagedFields(managedFields)
+
+	partial := &metav1.PartialObjectMetadata{}
+	partial.SetName("b")
+	partial.SetAnnotations(annotations)
+	partial.SetManagedFields(managedFields)
+
+	for _, obj := range []interface{}{uObj, partial} {
+		transformed, err := transform(obj)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		mObj := transformed.(metav1.Object)
+		if len(mObj.GetManagedFields()) != 0 {
+			t.Errorf("%s: expected managed fields to be dropped", mObj.GetName())
+		}
+		if !reflect.DeepEqual(mObj.GetAnnotations(), map[string]string{"keep": "true"}) {
+			t.Errorf("%s: unexpected annotations %v", mObj.GetName(), mObj.GetAnnotations())
+		}
+	}
+}
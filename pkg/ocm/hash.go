@@ -0,0 +1,60 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	workv1 "open-cluster-management.io/api/work/v1"
+)
+
+// ManifestHashAnnotationKey is the annotation of the ManifestWorks with the hash of their
+// content, used to skip applying ManifestWorks that did not change
+const ManifestHashAnnotationKey = "kubestellar.io/manifest-hash"
+
+// hashedContent is the content of a ManifestWork covered by the hash
+type hashedContent struct {
+	Labels map[string]string       `json:"labels,omitempty"`
+	Spec   workv1.ManifestWorkSpec `json:"spec"`
+}
+
+// SetManifestHash computes a hash of the labels and spec of the ManifestWork, which include
+// the wrapped object, and stores it in the ManifestHashAnnotationKey annotation.
+// The hash does not depend on the order of the fields of the wrapped object.
+func SetManifestHash(manifest *workv1.ManifestWork) error {
+	// the JSON encoding of maps, including those of unstructured objects, is sorted by key
+	data, err := json.Marshal(hashedContent{Labels: manifest.Labels, Spec: manifest.Spec})
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	annotations := manifest.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[ManifestHashAnnotationKey] = hex.EncodeToString(sum[:])
+	manifest.SetAnnotations(annotations)
+	return nil
+}
+
+// ManifestHashEqual returns true if both ManifestWorks carry the same content hash
+func ManifestHashEqual(a, b *workv1.ManifestWork) bool {
+	hash, ok := a.GetAnnotations()[ManifestHashAnnotationKey]
+	return ok && hash == b.GetAnnotations()[ManifestHashAnnotationKey]
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ocm
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newTestConfigMap(json string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON([]byte(json)); err != nil {
+		panic(err)
+	}
+	return obj
+}
+
+func TestManifestHash(t *testing.T) {
+	a := WrapObject(newTestConfigMap(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm","namespace":"ns"},"data":{"a":"1","b":"2"}}`))
+	b := WrapObject(newTestConfigMap(`{"kind":"ConfigMap","data":{"b":"2","a":"1"},"apiVersion":"v1","metadata":{"namespace":"ns","name":"cm"}}`))
+	a.SetLabels(map[string]string{"managed-by.kubestellar.io/wds1.p": "true"})
+	b.SetLabels(map[string]string{"managed-by.kubestellar.io/wds1.p": "true"})
+	if err := SetManifestHash(a); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := SetManifestHash(b); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !ManifestHashEqual(a, b) {
+		t.Errorf("expected the same content in a different order to have the same hash")
+	}
+
+	b.Labels["managed-by.kubestellar.io/wds1.q"] = "true"
+	if err := SetManifestHash(b); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ManifestHashEqual(a, b) {
+		t.Errorf("expected a change of the placement labels to change the hash")
+	}
+
+	c := WrapObject(newTestConfigMap(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm","namespace":"ns"},"data":{"a":"2"}}`))
+	c.SetLabels(a.Labels)
+	if err := SetManifestHash(c); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ManifestHashEqual(a, c) {
+		t.Errorf("expected a change of the wrapped object to change the hash")
+	}
+}
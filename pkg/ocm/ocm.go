@@ -17,7 +17,6 @@ limitations under the License.
 package ocm
 
 import (
-	"context"
 	"fmt"
 	"os"
 	"strings"
@@ -26,9 +25,8 @@ import (
 	workv1 "open-cluster-management.io/api/work/v1"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
@@ -59,6 +57,83 @@ func WrapObject(obj runtime.Object) *workv1.ManifestWork {
 	}
 }
 
+// status fields returned as feedback by the work agent when the status add-on is not
+// available. Paths that do not exist in the status of an object are not returned.
+// The values of lists and objects (e.g. conditions) are returned as raw JSON, which
+// requires the RawFeedbackJsonString feature gate to be enabled on the work agent.
+var statusFeedbackPaths = []string{
+	"replicas",
+	"readyReplicas",
+	"availableReplicas",
+	"updatedReplicas",
+	"observedGeneration",
+	"currentRevision",
+	"updateRevision",
+	"desiredNumberScheduled",
+	"updatedNumberScheduled",
+	"numberAvailable",
+	"active",
+	"succeeded",
+	"failed",
+	"phase",
+	"conditions",
+	"loadBalancer",
+}
+
+// SetStatusFeedbackRules configures the ManifestWork wrapping an object so that the work
+// agent returns the status of the object as feedback in the ManifestWork status
+func SetStatusFeedbackRules(manifest *workv1.ManifestWork, gvr schema.GroupVersionResource, obj metav1.Object) {
+	jsonPaths := make([]workv1.JsonPath, 0, len(statusFeedbackPaths))
+	for _, path := range statusFeedbackPaths {
+		jsonPaths = append(jsonPaths, workv1.JsonPath{Name: path, Path: "." + path})
+	}
+	manifestConfig(manifest, gvr, obj).FeedbackRules = []workv1.FeedbackRule{
+		{Type: workv1.WellKnownStatusType},
+		{Type: workv1.JSONPathsType, JsonPaths: jsonPaths},
+	}
+}
+
+// SetUpdateStrategy configures the ManifestWork wrapping an object so that the work agent
+// updates the object with the given strategy. A nil strategy leaves the default of the
+// work agent.
+func SetUpdateStrategy(manifest *workv1.ManifestWork, gvr schema.GroupVersionResource, obj metav1.Object,
+	strategy *workv1.UpdateStrategy) {
+	if strategy == nil {
+		return
+	}
+	manifestConfig(manifest, gvr, obj).UpdateStrategy = strategy
+}
+
+// manifestConfig returns the configuration of the wrapped object, added if missing
+func manifestConfig(manifest *workv1.ManifestWork, gvr schema.GroupVersionResource, obj metav1.Object) *workv1.ManifestConfigOption {
+	id := workv1.ResourceIdentifier{
+		Group:     gvr.Group,
+		Resource:  gvr.Resource,
+		Name:      obj.GetName(),
+		Namespace: obj.GetNamespace(),
+	}
+	for i := range manifest.Spec.ManifestConfigs {
+		if manifest.Spec.ManifestConfigs[i].ResourceIdentifier == id {
+			return &manifest.Spec.ManifestConfigs[i]
+		}
+	}
+	manifest.Spec.ManifestConfigs = append(manifest.Spec.ManifestConfigs, workv1.ManifestConfigOption{ResourceIdentifier: id})
+	return &manifest.Spec.ManifestConfigs[len(manifest.Spec.ManifestConfigs)-1]
+}
+
+// SetOrphanOnDeletion configures the ManifestWork so that the work agent leaves the
+// wrapped objects on the cluster, no longer managed, when the ManifestWork is deleted
+func SetOrphanOnDeletion(manifest *workv1.ManifestWork) {
+	manifest.Spec.DeleteOption = &workv1.DeleteOption{PropagationPolicy: workv1.DeletePropagationPolicyTypeOrphan}
+}
+
+// IsOrphanOnDeletion returns true if the deletion of the ManifestWork leaves the wrapped
+// objects on the cluster
+func IsOrphanOnDeletion(manifest *workv1.ManifestWork) bool {
+	return manifest.Spec.DeleteOption != nil &&
+		manifest.Spec.DeleteOption.PropagationPolicy == workv1.DeletePropagationPolicyTypeOrphan
+}
+
 // BuildEmptyManifestFromObject creates an empty ManifestWork which can be used to delete
 func BuildEmptyManifestFromObject(obj runtime.Object) *workv1.ManifestWork {
 	return &workv1.ManifestWork{
@@ -143,57 +218,3 @@ func RemoveChar(s string, c rune) string {
 	}
 	return s[:i] + s[i+1:]
 }
-
-func GetClusterByName(ocmClient client.Client, clusterName string) (clusterv1.ManagedCluster, error) {
-	cluster := clusterv1.ManagedCluster{}
-	nn := types.NamespacedName{
-		Namespace: "",
-		Name:      clusterName,
-	}
-	if err := ocmClient.Get(context.TODO(), nn, &cluster); err != nil {
-		return cluster, err
-	}
-	return cluster, nil
-}
-
-func ListClustersBySelectors(ocmClient client.Client, selectors []metav1.LabelSelector) ([]string, error) {
-	clusters := &clusterv1.ManagedClusterList{}
-	labelSelectors := []labels.Selector{}
-	for _, s := range selectors {
-		selector, err := metav1.LabelSelectorAsSelector(&s)
-		if err != nil {
-			return nil, err
-		}
-		labelSelectors = append(labelSelectors, selector)
-	}
-	labelsMap, err := convertLabelSelectorsToMap(labelSelectors)
-	if err != nil {
-		return nil, err
-	}
-	if err := ocmClient.List(context.TODO(), clusters, client.MatchingLabels(labelsMap)); err != nil {
-		return nil, err
-	}
-	if len(clusters.Items) == 0 {
-		return nil, nil
-	}
-	clusterNames := []string{}
-	for _, cluster := range clusters.Items {
-		clusterNames = append(clusterNames, cluster.GetName())
-	}
-	return clusterNames, nil
-}
-
-func convertLabelSelectorsToMap(labelSelectors []labels.Selector) (map[string]string, error) {
-	labelsMap := make(map[string]string)
-	for _, selector := range labelSelectors {
-		strSelector := selector.String()
-		labelSet, err := labels.ConvertSelectorToLabelsMap(strSelector)
-		if err != nil {
-			return nil, err
-		}
-		for key, value := range labelSet {
-			labelsMap[key] = value
-		}
-	}
-	return labelsMap, nil
-}
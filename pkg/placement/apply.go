@@ -0,0 +1,104 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"sort"
+	"strings"
+
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubestellar/kubestellar/api/edge/v1alpha1"
+	"github.com/kubestellar/kubestellar/pkg/util"
+)
+
+// precedence of the update strategies when multiple placements select an object,
+// from the one overwriting the object in the cluster the most to the least
+var updateStrategyRank = map[v1alpha1.UpdateStrategyType]int{
+	v1alpha1.UpdateStrategyUpdate:          1,
+	v1alpha1.UpdateStrategyServerSideApply: 2,
+	v1alpha1.UpdateStrategyCreateOnly:      3,
+}
+
+// objectApplyOptions returns the apply options set by the annotations of the object,
+// if the update strategy annotation is valid
+func objectApplyOptions(obj metav1.Object) (*v1alpha1.ApplyOptions, bool) {
+	annotations := obj.GetAnnotations()
+	strategy := v1alpha1.UpdateStrategyType(annotations[util.AnnotationUpdateStrategyKey])
+	if _, ok := updateStrategyRank[strategy]; !ok {
+		return nil, false
+	}
+	options := &v1alpha1.ApplyOptions{
+		UpdateStrategy: strategy,
+		Force:          annotations[util.AnnotationForceApplyKey] == "true",
+	}
+	// the ManifestWork is rejected with other field managers
+	if fieldManager := annotations[util.AnnotationFieldManagerKey]; strings.HasPrefix(fieldManager, workv1.DefaultFieldManager) {
+		options.FieldManager = fieldManager
+	}
+	return options, true
+}
+
+// updateStrategy returns the update strategy of the object delivered on behalf of the
+// placements: the one of the annotations of the object if set, otherwise the strategy of
+// the placements that overwrites the object the least, the first placement by name
+// giving the server-side apply configuration. Returns nil for the default of the work agent.
+func (c *Controller) updateStrategy(obj metav1.Object, placementNames []string) *workv1.UpdateStrategy {
+	if options, ok := objectApplyOptions(obj); ok {
+		return toUpdateStrategy(options)
+	}
+	names := append([]string{}, placementNames...)
+	sort.Strings(names)
+	var chosen *v1alpha1.ApplyOptions
+	for _, name := range names {
+		placement, ok := c.placements.get(name)
+		if !ok || placement.applyOptions == nil {
+			continue
+		}
+		rank, ok := updateStrategyRank[placement.applyOptions.UpdateStrategy]
+		if !ok {
+			continue
+		}
+		if chosen == nil || rank > updateStrategyRank[chosen.UpdateStrategy] {
+			chosen = placement.applyOptions
+		}
+	}
+	return toUpdateStrategy(chosen)
+}
+
+// the Update strategy is the default of the work agent, and is left unset so that the
+// ManifestWorks delivered without options do not change
+func toUpdateStrategy(options *v1alpha1.ApplyOptions) *workv1.UpdateStrategy {
+	if options == nil {
+		return nil
+	}
+	switch options.UpdateStrategy {
+	case v1alpha1.UpdateStrategyCreateOnly:
+		return &workv1.UpdateStrategy{Type: workv1.UpdateStrategyTypeCreateOnly}
+	case v1alpha1.UpdateStrategyServerSideApply:
+		return &workv1.UpdateStrategy{
+			Type: workv1.UpdateStrategyTypeServerSideApply,
+			ServerSideApply: &workv1.ServerSideApplyConfig{
+				Force:        options.Force,
+				FieldManager: options.FieldManager,
+			},
+		}
+	}
+	return nil
+}
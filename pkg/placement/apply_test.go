@@ -0,0 +1,90 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/kubestellar/kubestellar/api/edge/v1alpha1"
+	"github.com/kubestellar/kubestellar/pkg/ocm"
+)
+
+func TestUpdateStrategy(t *testing.T) {
+	c := &Controller{placements: newPlacementIndex(logr.Discard())}
+	for name, options := range map[string]*v1alpha1.ApplyOptions{
+		"create-only": {UpdateStrategy: v1alpha1.UpdateStrategyCreateOnly},
+		"ssa-a":       {UpdateStrategy: v1alpha1.UpdateStrategyServerSideApply, Force: true, FieldManager: "work-agent-a"},
+		"ssa-b":       {UpdateStrategy: v1alpha1.UpdateStrategyServerSideApply},
+		"update":      {UpdateStrategy: v1alpha1.UpdateStrategyUpdate},
+	} {
+		placement := newTestPlacement(name, 1)
+		placement.Spec.ApplyOptions = options
+		c.placements.update(placement)
+	}
+	c.placements.update(newTestPlacement("default", 1))
+
+	plain := &metav1.ObjectMeta{Name: "cm"}
+	annotated := &metav1.ObjectMeta{Name: "cm", Annotations: map[string]string{
+		"annotations.kubestellar.io/update-strategy": "ServerSideApply",
+		"annotations.kubestellar.io/force-apply":     "true",
+		"annotations.kubestellar.io/field-manager":   "other",
+	}}
+	for _, tc := range []struct {
+		name       string
+		obj        metav1.Object
+		placements []string
+		expected   *workv1.UpdateStrategy
+	}{
+		{"default", plain, []string{"default", "update"}, nil},
+		{"create only rules", plain, []string{"ssa-a", "create-only", "update"}, &workv1.UpdateStrategy{Type: workv1.UpdateStrategyTypeCreateOnly}},
+		{"first server-side apply by name", plain, []string{"ssa-b", "ssa-a"}, &workv1.UpdateStrategy{
+			Type:            workv1.UpdateStrategyTypeServerSideApply,
+			ServerSideApply: &workv1.ServerSideApplyConfig{Force: true, FieldManager: "work-agent-a"},
+		}},
+		{"annotations rule", annotated, []string{"create-only"}, &workv1.UpdateStrategy{
+			Type:            workv1.UpdateStrategyTypeServerSideApply,
+			ServerSideApply: &workv1.ServerSideApplyConfig{Force: true},
+		}},
+	} {
+		strategy := c.updateStrategy(tc.obj, tc.placements)
+		if (strategy == nil) != (tc.expected == nil) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.expected, strategy)
+		}
+		if strategy == nil {
+			continue
+		}
+		if strategy.Type != tc.expected.Type || (strategy.ServerSideApply == nil) != (tc.expected.ServerSideApply == nil) ||
+			(strategy.ServerSideApply != nil && *strategy.ServerSideApply != *tc.expected.ServerSideApply) {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, tc.expected, strategy)
+		}
+	}
+
+	// the update strategy and the status feedback rules share the configuration of the object
+	manifest := &workv1.ManifestWork{}
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	ocm.SetStatusFeedbackRules(manifest, gvr, plain)
+	ocm.SetUpdateStrategy(manifest, gvr, plain, &workv1.UpdateStrategy{Type: workv1.UpdateStrategyTypeCreateOnly})
+	if configs := manifest.Spec.ManifestConfigs; len(configs) != 1 || configs[0].UpdateStrategy == nil || len(configs[0].FeedbackRules) == 0 {
+		t.Errorf("expected a single configuration with feedback rules and update strategy, got %+v", configs)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"context"
+	"time"
+
+	clusterclientset "open-cluster-management.io/api/client/cluster/clientset/versioned"
+	clusterinformers "open-cluster-management.io/api/client/cluster/informers/externalversions/cluster/v1"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubestellar/kubestellar/pkg/util"
+)
+
+// mailboxCleanup is the workqueue item used to request the removal of the ManifestWorks
+// of this WDS from the mailbox namespace of a deleted cluster
+type mailboxCleanup string
+
+// the ManagedClusters in the IMBS are cached to evaluate the cluster selectors of the
+// placements. When clusters join, change labels or are removed, the cluster sets cached
+// by the placement index are dropped and the placements whose selection changed are
+// reconciled, so that objects are delivered to or withdrawn from the clusters.
+func (c *Controller) newClusterInformer(imbsRestConfig *rest.Config) (cache.SharedIndexInformer, error) {
+	clusterClient, err := clusterclientset.NewForConfig(imbsRestConfig)
+	if err != nil {
+		return nil, err
+	}
+	informer := clusterinformers.NewManagedClusterInformer(clusterClient, 0*time.Minute, cache.Indexers{})
+	informer.SetTransform(c.dropFields)
+	informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			if isInInitialList {
+				// clusters are evaluated when placements are first reconciled
+				c.placements.invalidateClusters()
+				return
+			}
+			c.handleClusterChange(obj.(metav1.Object).GetName(), nil, false, obj.(metav1.Object).GetLabels(), true)
+		},
+		UpdateFunc: func(old, new interface{}) {
+			oldLabels := old.(metav1.Object).GetLabels()
+			newLabels := new.(metav1.Object).GetLabels()
+			if labels.Equals(oldLabels, newLabels) {
+				return
+			}
+			c.handleClusterChange(new.(metav1.Object).GetName(), oldLabels, true, newLabels, true)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			mObj, ok := obj.(metav1.Object)
+			if !ok {
+				c.placements.invalidateClusters()
+				return
+			}
+			c.handleClusterChange(mObj.GetName(), mObj.GetLabels(), true, nil, false)
+			c.delivery.forgetCluster(mObj.GetName())
+			c.workqueue.Add(mailboxCleanup(mObj.GetName()), classDeletion)
+		},
+	})
+	return informer, nil
+}
+
+// handleClusterChange drops the cached cluster sets and enqueues the placements whose
+// selection of the cluster changed, with all their tests pending requeue: objects are
+// delivered to a newly selected cluster by reconciling them, while objects delivered to
+// a cluster no longer selected are withdrawn by the placement cleanup.
+func (c *Controller) handleClusterChange(name string, oldLabels map[string]string, oldExists bool,
+	newLabels map[string]string, newExists bool) {
+	affected := c.placements.affectedByClusterChange(oldLabels, oldExists, newLabels, newExists)
+	c.placements.invalidateClusters()
+	for _, p := range affected {
+		c.logger.Info("Cluster selection changed, reconciling placement", "cluster", name, "placement", p.name)
+		c.placements.addPendingRequeue(p.name, p.downsync)
+		c.workqueue.AddAfter(util.Key{
+			GvkKey:         util.GetPlacementListerKey(),
+			NamespacedName: cache.ObjectName{Name: p.name},
+		}, classPlacement, placementCoalescePeriod)
+	}
+}
+
+// cleanupMailbox deletes the ManifestWorks of this WDS from the mailbox namespace of a
+// deleted cluster. ManifestWorks of other WDSs sharing the IMBS are left untouched.
+func (c *Controller) cleanupMailbox(ctx context.Context, cluster string) error {
+	if !c.ownsCluster(cluster) {
+		return nil
+	}
+	if _, err := c.clusterLister.Get(cluster); err == nil {
+		// the cluster was created again
+		return nil
+	}
+	c.logger.Info("Cluster removed, deleting ManifestWorks from its mailbox", "cluster", cluster)
+	err := c.ocmClient.DeleteAllOf(ctx, &workv1.ManifestWork{}, client.InNamespace(cluster),
+		client.MatchingLabels{util.WDSLabelKey: c.wdsName})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// listClusters returns the names of the clusters selected by the placement
+func (c *Controller) listClusters(p *compiledPlacement) (sets.Set[string], error) {
+	clusters, err := c.clusterLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	names := sets.New[string]()
+	for _, cluster := range clusters {
+		if p.selectsCluster(cluster.GetLabels()) {
+			names.Insert(cluster.GetName())
+		}
+	}
+	return names, nil
+}
+
+// getClustersForPlacement returns the names of the clusters selected by the placement,
+// cached until the ManagedClusters change
+func (c *Controller) getClustersForPlacement(p *compiledPlacement) (sets.Set[string], error) {
+	return c.placements.getClusters(p, c.listClusters)
+}
@@ -21,75 +21,130 @@ import (
 	"fmt"
 	"reflect"
 	"sort"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	"golang.org/x/time/rate"
+	clusterlisters "open-cluster-management.io/api/client/cluster/listers/cluster/v1"
+	workv1 "open-cluster-management.io/api/work/v1"
 
 	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	ctrlm "sigs.k8s.io/controller-runtime/pkg/manager"
 
+	"github.com/kubestellar/kubestellar/api/edge/v1alpha1"
 	"github.com/kubestellar/kubestellar/pkg/crd"
+	"github.com/kubestellar/kubestellar/pkg/informers"
 	"github.com/kubestellar/kubestellar/pkg/ocm"
 	"github.com/kubestellar/kubestellar/pkg/util"
 )
 
-// Resources group versions to exclude for watchers as they should not delivered to other clusters
-var excludedGroupVersions = map[string]bool{
-	"flowcontrol.apiserver.k8s.io/v1beta3": true,
-	"flowcontrol.apiserver.k8s.io/v1beta2": true,
-	"scheduling.k8s.io/v1":                 true,
-	"discovery.k8s.io/v1":                  true,
-	"apiregistration.k8s.io/v1":            true,
-	"coordination.k8s.io/v1":               true,
-}
-
-// Resource names to exclude for watchers as they should not delivered to other clusters
-// TODO - add also group version to qualify and avoid filtering when same names used on
-// user-supplied CRDs
-var excludedResourceNames = map[string]bool{
-	"events":               true,
-	"nodes":                true,
-	"csistoragecapacities": true,
-	"csinodes":             true,
-	"endpoints":            true,
-}
-
 // Controller watches all objects, finds associated placements, when matched a placement wraps and
 // places objects into mailboxes
 type Controller struct {
-	ctx              context.Context
 	logger           logr.Logger
 	ocmClient        client.Client
 	dynamicClient    *dynamic.DynamicClient
+	metadataClient   metadata.Interface
 	kubernetesClient *kubernetes.Clientset
 	extClient        *apiextensionsclientset.Clientset
-	listers          map[string]*cache.GenericLister
-	gvksMap          map[string]*schema.GroupVersionResource
-	informers        map[string]*cache.SharedIndexInformer
-	stoppers         map[string]chan struct{}
-	workqueue        workqueue.RateLimitingInterface
-	initializedTs    time.Time
-	wdsName          string
+	registry         *informers.Registry
+	// watchLock serializes starting and stopping informers, and protects watchedSelection
+	watchLock        sync.Mutex
+	watchedSelection resourceSelection
+	// namespaces are cached to evaluate NamespaceSelectors, independently of the
+	// resources selected by placements
+	namespaceInformer cache.SharedIndexInformer
+	// compiled placements, indexed by the objects they can select
+	placements           *placementIndex
+	placementIndexSynced cache.InformerSynced
+	clusterInformer      cache.SharedIndexInformer
+	clusterLister        clusterlisters.ManagedClusterLister
+	// ManifestWorks of this WDS, indexed by placement and by wrapped object
+	manifestWorkInformer cache.SharedIndexInformer
+	workqueue            *priorityQueue
+	// ManifestWork writes waiting for the write budgets
+	delivery      *deliveryQueue
+	initializedTs time.Time
+	wdsName       string
+	// when true, ManifestWorks are configured to return the status of the wrapped
+	// objects as feedback, used in place of the status add-on when it is not available
+	statusFeedback bool
+	resourceFilter *ResourceFilter
+	// transform dropping unused fields from the objects cached by the informers
+	dropFields cache.TransformFunc
+	// number of workers processing the workqueue
+	workers int
+	// nil when the controller is not sharded
+	sharder Sharder
+	// when true, ObjectFinalizer is added to the delivered objects
+	objectFinalizer bool
+	// garbage collection of orphaned ManifestWorks
+	gc        GCOptions
+	gcLimiter *rate.Limiter
+	// period of the API discovery reconciliation
+	discoveryPeriod time.Duration
+	// group versions whose discovery failed in the last API discovery
+	discoveryLock sync.Mutex
+	failedGroups  sets.Set[schema.GroupVersion]
+}
+
+// Options configures the placement controller
+type Options struct {
+	// StatusFeedback configures ManifestWorks to return the status of the wrapped objects
+	// as feedback, for use when the status add-on is not available
+	StatusFeedback bool
+	// ResourceFilter selects the API resources that are watched by the controller.
+	// If nil, DefaultExcludedResources are excluded.
+	ResourceFilter *ResourceFilter
+	// ObjectCacheSize is the number of full objects cached for delivery, as the informers
+	// used for matching only cache metadata. If not positive, the informers default is used.
+	ObjectCacheSize int
+	// DroppedFields are the fields dropped from the objects cached by the informers, in the
+	// form accepted by informers.ParseFieldPath. If nil, informers.DefaultDroppedFields are dropped.
+	DroppedFields []string
+	// DiscoveryPeriod is the period of the API discovery reconciliation, which starts and
+	// stops informers for the APIs not backed by CRDs and retries failed groups.
+	// If not positive, DefaultDiscoveryPeriod is used.
+	DiscoveryPeriod time.Duration
+	// DeliveryLimits are the budgets of the ManifestWork writes to the IMBS.
+	// If nil, DefaultDeliveryLimits are used.
+	DeliveryLimits *DeliveryLimits
+	// Sharder selects the objects reconciled by this replica. If nil, the controller
+	// is not sharded and runs in the replica elected leader.
+	Sharder Sharder
+	// Workers is the number of workers processing the workqueue. If not positive, one
+	// worker is run.
+	Workers int
+	// ObjectFinalizer adds ObjectFinalizer to the objects delivered to clusters, so that
+	// their deletion is propagated to the clusters even if the controller is not running
+	// when they are deleted. Objects with the finalizer cannot be deleted while the
+	// controller is not running, so the finalizer must be removed from the objects
+	// before the controller is uninstalled.
+	ObjectFinalizer bool
+	// GC configures the garbage collection of orphaned ManifestWorks.
+	// If nil, DefaultGCOptions are used.
+	GC *GCOptions
 }
 
 // Create a new placement controller
-func NewController(mgr ctrlm.Manager, wdsRestConfig *rest.Config, imbsRestConfig *rest.Config, wdsName string) (*Controller, error) {
+func NewController(mgr ctrlm.Manager, wdsRestConfig *rest.Config, imbsRestConfig *rest.Config, wdsName string,
+	opts Options) (*Controller, error) {
 	ratelimiter := workqueue.NewMaxOfRateLimiter(
 		workqueue.NewItemExponentialFailureRateLimiter(5*time.Millisecond, 1000*time.Second),
 		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(50), 300)},
@@ -100,6 +155,11 @@ func NewController(mgr ctrlm.Manager, wdsRestConfig *rest.Config, imbsRestConfig
 		return nil, err
 	}
 
+	metadataClient, err := metadata.NewForConfig(wdsRestConfig)
+	if err != nil {
+		return nil, err
+	}
+
 	kubernetesClient, err := kubernetes.NewForConfig(wdsRestConfig)
 	if err != nil {
 		return nil, err
@@ -112,46 +172,79 @@ func NewController(mgr ctrlm.Manager, wdsRestConfig *rest.Config, imbsRestConfig
 
 	ocmClient := *ocm.GetOCMClient(imbsRestConfig)
 
+	resourceFilter := opts.ResourceFilter
+	if resourceFilter == nil {
+		if resourceFilter, err = NewResourceFilter(DefaultExcludedResources, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	droppedFields := opts.DroppedFields
+	if droppedFields == nil {
+		droppedFields = informers.DefaultDroppedFields
+	}
+	dropFields, err := informers.NewDropFieldsTransform(droppedFields)
+	if err != nil {
+		return nil, err
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	discoveryPeriod := opts.DiscoveryPeriod
+	if discoveryPeriod <= 0 {
+		discoveryPeriod = DefaultDiscoveryPeriod
+	}
+
 	controller := &Controller{
 		wdsName:          wdsName,
+		statusFeedback:   opts.StatusFeedback,
+		resourceFilter:   resourceFilter,
+		dropFields:       dropFields,
+		discoveryPeriod:  discoveryPeriod,
+		workers:          workers,
+		sharder:          opts.Sharder,
+		objectFinalizer:  opts.ObjectFinalizer,
 		logger:           mgr.GetLogger(),
 		ocmClient:        ocmClient,
 		dynamicClient:    dynamicClient,
+		metadataClient:   metadataClient,
 		kubernetesClient: kubernetesClient,
 		extClient:        extClient,
-		listers:          make(map[string]*cache.GenericLister),
-		informers:        make(map[string]*cache.SharedIndexInformer),
-		stoppers:         make(map[string]chan struct{}),
-		gvksMap:          make(map[string]*schema.GroupVersionResource),
-		workqueue:        workqueue.NewRateLimitingQueue(ratelimiter),
+		registry:         informers.NewRegistry(informers.NewObjectFetcher(dynamicClient, opts.ObjectCacheSize)),
+		workqueue:        newPriorityQueue(ratelimiter),
+	}
+	deliveryLimits := DefaultDeliveryLimits()
+	if opts.DeliveryLimits != nil {
+		deliveryLimits = *opts.DeliveryLimits
+	}
+	controller.delivery = newDeliveryQueue(deliveryLimits, controller.applyManifest)
+	controller.gc = DefaultGCOptions()
+	if opts.GC != nil {
+		controller.gc = *opts.GC
+	}
+	controller.gcLimiter = newLimiter(controller.gc.QPS, controller.gc.Burst)
+	controller.namespaceInformer = controller.newNamespaceInformer()
+	controller.placements = newPlacementIndex(controller.logger)
+	controller.clusterInformer, err = controller.newClusterInformer(imbsRestConfig)
+	if err != nil {
+		return nil, err
+	}
+	controller.clusterLister = clusterlisters.NewManagedClusterLister(controller.clusterInformer.GetIndexer())
+	controller.manifestWorkInformer, err = controller.newManifestWorkInformer(imbsRestConfig)
+	if err != nil {
+		return nil, err
 	}
 
 	return controller, nil
 }
 
-// Start the controller
-func (c *Controller) Start(workers int) error {
-	ctx, cancel := context.WithCancel(context.Background())
-	c.ctx = ctx
-	defer cancel()
-
-	errChan := make(chan error, 1)
-	go func() {
-		errChan <- c.run(workers)
-	}()
-
-	// check for errors at startup, after all started we let it continue
-	// so we can start the controller-runtime manager
-	select {
-	case err := <-errChan:
-		return err
-	case <-time.After(3 * time.Second):
-		return nil
-	}
-}
-
-// Invoked by Start() to run the controller
-func (c *Controller) run(workers int) error {
+// Start runs the controller until the context is cancelled. The controller is a
+// manager.Runnable, so it is started by the manager once this replica is elected leader
+// and stopped with the manager. On shutdown, the workqueue is drained.
+func (c *Controller) Start(ctx context.Context) error {
 	defer c.workqueue.ShutDown()
 
 	// ensure CRDs are installed before starting up
@@ -159,95 +252,235 @@ func (c *Controller) run(workers int) error {
 		return err
 	}
 
-	// Get all the api resources in the cluster
-	apiResources, err := c.kubernetesClient.Discovery().ServerPreferredResources()
+	// Get the api resources required by the controller. The informers for the resources
+	// selected by placements are started once the placements are known.
+	apiResources, _, err := c.getAPIResourcesToWatch(resourceSelection{})
 	if err != nil {
-		// ignore the error caused by a stale API service
-		if !strings.Contains(err.Error(), util.UnableToRetrieveCompleteAPIListError) {
-			return err
-		}
+		return err
 	}
 
-	// Create a dynamic shared informer factory
-	informerFactory := dynamicinformer.NewDynamicSharedInformerFactory(c.dynamicClient, 0*time.Minute)
+	// the informers are stopped when the controller shuts down
+	defer c.registry.Stop()
+	for _, apiResource := range apiResources {
+		c.startInformer(apiResource)
+	}
 
-	// Loop through the api resources and create informers and listers for each of them
+	go c.namespaceInformer.Run(ctx.Done())
+	go c.clusterInformer.Run(ctx.Done())
+	go c.manifestWorkInformer.Run(ctx.Done())
+	if ok := cache.WaitForCacheSync(ctx.Done(), c.namespaceInformer.HasSynced, c.clusterInformer.HasSynced,
+		c.manifestWorkInformer.HasSynced); !ok {
+		return fmt.Errorf("failed to wait for namespaces, clusters and manifestworks caches to sync")
+	}
 
-	for _, group := range apiResources {
-		if _, excluded := excludedGroupVersions[group.GroupVersion]; excluded {
-			continue
-		}
-		gv, err := schema.ParseGroupVersion(group.GroupVersion)
-		if err != nil {
-			c.logger.Error(err, "Failed to parse a GroupVersion", "groupVersion", group.GroupVersion)
-			continue
-		}
-		for _, resource := range group.APIResources {
-			if _, excluded := excludedResourceNames[resource.Name]; excluded {
-				continue
-			}
-			informable := verbsSupportInformers(resource.Verbs)
-			if informable {
-				key := util.KeyForGroupVersionKind(gv.Group, gv.Version, resource.Kind)
-				informer := informerFactory.ForResource(gv.WithResource(resource.Name)).Informer()
-				c.informers[key] = &informer
-
-				// add the event handler functions
-				informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-					AddFunc: c.handleObject,
-					UpdateFunc: func(old, new interface{}) {
-						if shouldSkipUpdate(old, new) {
-							return
-						}
-						c.handleObject(new)
-					},
-					DeleteFunc: func(obj interface{}) {
-						if shouldSkipDelete(obj) {
-							return
-						}
-						c.handleObject(obj)
-					},
-				})
-
-				// create and index the lister
-				lister := cache.NewGenericLister(informer.GetIndexer(), schema.GroupResource{Group: resource.Group, Resource: resource.Name})
-				c.listers[key] = &lister
-				c.gvksMap[key] = &schema.GroupVersionResource{Group: resource.Group, Version: resource.Version, Resource: resource.Name}
-
-				// run the informer
-				// we need to be able to stop informers for APIs (CRDs) that are removed
-				// after startup, therefore we use a stopper channel for each informer
-				// instead than informerFactory.Start(ctx.Done())
-				stopper := make(chan struct{})
-				defer close(stopper)
-				c.stoppers[key] = stopper
-				go informer.Run(stopper)
-			}
-		}
+	if err := c.waitForCacheSync(ctx); err != nil {
+		return err
+	}
+	if ok := cache.WaitForCacheSync(ctx.Done(), c.placementIndexSynced); !ok {
+		return fmt.Errorf("failed to wait for placements to be indexed")
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	// the ManifestWorks created by earlier releases are picked up by the informer once relabeled
+	if err := c.relabelLegacyManifestWorks(ctx); err != nil {
+		c.logger.Error(err, "Error relabeling legacy ManifestWorks")
+	}
 
-	// wait for all informers caches to be synced
-	for _, informer := range c.informers {
-		if ok := cache.WaitForCacheSync(ctx.Done(), (*informer).HasSynced); !ok {
-			return fmt.Errorf("failed to wait for caches to sync")
-		}
+	// start the informers for the resources selected by the existing placements
+	if err := c.updateWatchedResources(); err != nil {
+		return err
+	}
+	if err := c.waitForCacheSync(ctx); err != nil {
+		return err
 	}
 	c.logger.Info("All caches synced")
 
-	c.logger.Info("Starting workers", "count", workers)
-	for i := 0; i < workers; i++ {
-		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+	c.initializedTs = time.Now()
+	c.logger.Info("Starting workers", "count", c.workers)
+	// the workers do not use the manager context, so that the items taken from the
+	// workqueue when the controller is stopped are processed to completion
+	workerCtx, cancelWorkers := context.WithCancel(context.Background())
+	defer cancelWorkers()
+	var workersDone sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		workersDone.Add(1)
+		go func() {
+			defer workersDone.Done()
+			c.runWorker(workerCtx)
+		}()
 	}
-
 	c.logger.Info("Started workers")
-	c.initializedTs = time.Now()
+
+	// the informers are stopped once the discovery and the garbage collection returned
+	var backgroundDone sync.WaitGroup
+	backgroundDone.Add(2)
+	go func() {
+		defer backgroundDone.Done()
+		c.runDiscovery(ctx)
+	}()
+	go func() {
+		defer backgroundDone.Done()
+		c.runGC(ctx)
+	}()
+
+	// the objects were enqueued before the caches synced only if their shards were
+	// already claimed; reconcile all the objects of the shards claimed from now on
+	if c.sharder != nil {
+		c.sharder.AddChangeHandler(func() {
+			go c.requeueAll()
+		})
+		c.requeueAll()
+	}
+
+	deliveryDone := make(chan struct{})
+	go func() {
+		defer close(deliveryDone)
+		c.delivery.run(ctx, c.workers)
+	}()
 
 	<-ctx.Done()
-	c.logger.Info("Shutting down workers")
+	c.logger.Info("Shutting down workers, draining the workqueue")
+	c.workqueue.ShutDownWithDrain()
+	workersDone.Wait()
+	<-deliveryDone
+	backgroundDone.Wait()
+	c.logger.Info("Workers stopped")
+
+	return nil
+}
+
+var _ ctrlm.LeaderElectionRunnable = &Controller{}
+
+// applyManifest writes a ManifestWork to the mailbox, invoked by the delivery queue
+func (c *Controller) applyManifest(w *deliveryWrite) {
+	if err := reconcileManifest(c.ocmClient, w.manifest, w.cluster); err != nil {
+		manifestApplies.WithLabelValues(applyResultError).Inc()
+		c.logger.Error(err, "Error delivering object to mailbox", "manifest", w.manifest.Name, "cluster", w.cluster)
+		// the object is reconciled again, which writes the ManifestWork unless it is up to date
+		c.workqueue.AddRateLimited(w.key)
+		return
+	}
+	manifestApplies.WithLabelValues(applyResultApplied).Inc()
+}
+
+// cancelObjectDeliveries cancels the writes of the ManifestWorks wrapping the object,
+// which is withdrawn from all the clusters, and returns the ManifestWorks that may have
+// been written to the mailboxes without being in the cache yet
+func (c *Controller) cancelObjectDeliveries(key util.Key) []workv1.ManifestWork {
+	_, completed := c.delivery.cancel(func(w *deliveryWrite) bool {
+		return w.sameObject(key)
+	})
+	return writtenManifests(completed)
+}
+
+// cancelPlacementDeliveries cancels the writes on behalf of the placement, and requeues
+// their objects so that they are delivered again if still selected. Returns the
+// ManifestWorks that may have been written to the mailboxes without being in the cache yet.
+func (c *Controller) cancelPlacementDeliveries(name string) []workv1.ManifestWork {
+	return c.cancelDeliveries(func(w *deliveryWrite) bool {
+		return w.hasPlacement(name)
+	})
+}
+
+// cancelManifestDelivery cancels the writes of the ManifestWork to the mailbox of the
+// cluster, and requeues its object so that it is delivered again if still selected
+func (c *Controller) cancelManifestDelivery(cluster, name string) {
+	c.cancelDeliveries(func(w *deliveryWrite) bool {
+		return w.cluster == cluster && w.manifest.Name == name
+	})
+}
+
+func (c *Controller) cancelDeliveries(selected func(*deliveryWrite) bool) []workv1.ManifestWork {
+	dropped, completed := c.delivery.cancel(selected)
+	for _, w := range append(dropped, completed...) {
+		c.workqueue.Add(w.key, classRequeue)
+	}
+	return writtenManifests(completed)
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: only the leader
+// delivers objects to the clusters, unless the controller is sharded
+func (c *Controller) NeedLeaderElection() bool {
+	return c.sharder == nil
+}
+
+// newInformer creates the informer for an API resource. The controller only needs the
+// metadata of the objects to match them against placements, so only the metadata is
+// cached, except for the resources whose spec is used by the controller itself.
+// The full objects are retrieved from the registry when they are delivered.
+// Unused fields are dropped from the objects before they are cached.
+func (c *Controller) newInformer(apiResource APIResource) (cache.SharedIndexInformer, bool) {
+	gvr := apiResource.groupVersion.WithResource(apiResource.resource.Name)
+	if isRequiredResource(apiResource.groupVersion, apiResource.resource.Name) {
+		informer := dynamicinformer.NewFilteredDynamicInformer(c.dynamicClient, gvr, metav1.NamespaceAll,
+			0*time.Minute, cache.Indexers{}, nil).Informer()
+		informer.SetTransform(c.dropFields)
+		if gvr.Group == v1alpha1.GroupVersion.Group && gvr.Resource == util.PlacementResource {
+			if registration, err := informer.AddEventHandler(c.placements.eventHandler()); err == nil {
+				c.placementIndexSynced = registration.HasSynced
+			}
+		}
+		return informer, false
+	}
+
+	informer := metadatainformer.NewFilteredMetadataInformer(c.metadataClient, gvr, metav1.NamespaceAll,
+		0*time.Minute, cache.Indexers{}, nil).Informer()
+	// objects returned by the metadata API have the PartialObjectMetadata kind,
+	// set the kind of the resource so that they can be keyed and matched
+	gvk := apiResource.groupVersion.WithKind(apiResource.resource.Kind)
+	setKind := func(obj interface{}) (interface{}, error) {
+		if partial, ok := obj.(*metav1.PartialObjectMetadata); ok {
+			partial.SetGroupVersionKind(gvk)
+		}
+		return obj, nil
+	}
+	informer.SetTransform(informers.ChainTransforms(setKind, c.dropFields))
+	return informer, true
+}
+
+// startInformer creates the informer for an API resource, adds the event handlers and
+// registers it. The registry runs the informer until it is removed or the registry stopped.
+func (c *Controller) startInformer(apiResource APIResource) {
+	key := util.KeyForGroupVersionKind(apiResource.groupVersion.Group,
+		apiResource.groupVersion.Version, apiResource.resource.Kind)
+	gvr := apiResource.groupVersion.WithResource(apiResource.resource.Name)
+	informer, metadataOnly := c.newInformer(apiResource)
+
+	informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			// the objects listed when the informer starts are a background resync
+			if isInInitialList {
+				c.handleObject(obj, classResync)
+				return
+			}
+			c.handleObject(obj, classEdit)
+		},
+		UpdateFunc: func(old, new interface{}) {
+			if shouldSkipUpdate(old, new) {
+				return
+			}
+			c.handleObject(new, classEdit)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if shouldSkipDelete(obj) {
+				return
+			}
+			c.handleObject(obj, classEdit)
+		},
+	})
 
+	// register the informer, which also creates and indexes the lister and runs the informer
+	if metadataOnly {
+		c.registry.AddMetadataOnly(key, gvr, informer)
+		return
+	}
+	c.registry.Add(key, gvr, informer)
+}
+
+// wait for all informers caches to be synced
+func (c *Controller) waitForCacheSync(ctx context.Context) error {
+	if !c.registry.WaitForCacheSync(ctx) {
+		return fmt.Errorf("failed to wait for caches to sync")
+	}
 	return nil
 }
 
@@ -288,17 +521,23 @@ func verbsSupportInformers(verbs []string) bool {
 
 // Event handler: enqueues the objects to be processed
 // At this time it is very simple, more complex processing might be required here
-func (c *Controller) handleObject(obj any) {
+func (c *Controller) handleObject(obj any, class queueClass) {
 	mObj := obj.(metav1.Object)
 	rObj := obj.(runtime.Object)
 	ok := rObj.GetObjectKind()
 	gvk := ok.GroupVersionKind()
 	c.logger.V(2).Info("Got object event", gvk.GroupVersion().String(), gvk.Kind, mObj.GetNamespace(), mObj.GetName())
-	c.enqueueObject(obj, false)
+	c.enqueueObject(obj, class, false)
 }
 
 // enqueueObject converts an object into a key struct which is then put onto the work queue.
-func (c *Controller) enqueueObject(obj interface{}, skipCheckIsDeleted bool) {
+// Deleted objects are queued as deletions, and placements and CRDs as placement events,
+// whatever the class requested.
+func (c *Controller) enqueueObject(obj interface{}, class queueClass, skipCheckIsDeleted bool) {
+	// placements and CRDs are processed by all the shards
+	if !util.IsPlacement(obj) && !util.IsCRD(obj) && !c.ownsObject(obj.(runtime.Object)) {
+		return
+	}
 	var key util.Key
 	var err error
 	if key, err = util.KeyForGroupVersionKindNamespaceName(obj); err != nil {
@@ -317,12 +556,21 @@ func (c *Controller) enqueueObject(obj interface{}, skipCheckIsDeleted bool) {
 			if errors.IsNotFound(err) {
 				deletedObj := copyObjectMetaAndType(obj.(runtime.Object))
 				key.DeletedObject = &deletedObj
-				c.workqueue.Add(key)
+				c.workqueue.Add(key, classDeletion)
 			}
 			return
 		}
 	}
-	c.workqueue.Add(key)
+	// delay placement events so that bursts of edits are coalesced into a single
+	// reconcile, as the workqueue does not add an item that is already waiting
+	if util.IsPlacement(obj) {
+		c.workqueue.AddAfter(key, classPlacement, placementCoalescePeriod)
+		return
+	}
+	if util.IsCRD(obj) {
+		class = classPlacement
+	}
+	c.workqueue.Add(key, class)
 }
 
 // runWorker is a long-running function that will continually call the
@@ -350,21 +598,25 @@ func (c *Controller) processNextWorkItem(ctx context.Context) bool {
 		// put back on the workqueue and attempted again after a back-off
 		// period.
 		defer c.workqueue.Done(obj)
-		var key util.Key
-		var ok bool
 		// We expect util.Key to come off the workqueue. We do this as the delayed
 		// nature of the workqueue means the items in the informer cache may actually be
 		// more up to date that when the item was initially put onto the
-		// workqueue.
-		if key, ok = obj.(util.Key); !ok {
+		// workqueue. Mailboxes of deleted clusters are also cleaned up by the workers.
+		var err error
+		switch item := obj.(type) {
+		case util.Key:
+			// Run the reconciler, passing it the full key or the metav1 Object
+			err = c.reconcile(ctx, item)
+		case mailboxCleanup:
+			err = c.cleanupMailbox(ctx, string(item))
+		default:
 			// if the item in the workqueue is invalid, we call
 			// Forget here to avoid process a work item that is invalid.
 			c.workqueue.Forget(obj)
 			utilruntime.HandleError(fmt.Errorf("expected util.Key in workqueue but got %#v", obj))
 			return nil
 		}
-		// Run the reconciler, passing it the full key or the metav1 Object
-		if err := c.reconcile(ctx, key); err != nil {
+		if err != nil {
 			// Put the item back on the workqueue to handle any transient errors.
 			c.workqueue.AddRateLimited(obj)
 			return fmt.Errorf("error syncing key '%#v': %s, requeuing", obj, err.Error())
@@ -413,10 +665,31 @@ func (c *Controller) reconcile(ctx context.Context, key util.Key) error {
 		if err := c.handleCRD(obj); err != nil {
 			return err
 		}
+		if !c.ownsObject(obj) {
+			return nil
+		}
 	}
 
-	// avoid further processing for keys of objects being deleted that do not have a deleted object
+	// objects being deleted are withdrawn from the clusters before their finalizer is
+	// removed, or when the delete event is processed for objects without the finalizer
 	if isBeingDeleted(obj) && key.DeletedObject == nil {
+		return c.finalizeObject(ctx, key, obj)
+	}
+
+	// the object is withdrawn from the clusters it was delivered to, whatever the placements
+	// select now
+	if key.DeletedObject != nil {
+		written := c.cancelObjectDeliveries(key)
+		manifests, err := c.listManifestsForObject(obj)
+		if err != nil {
+			return err
+		}
+		manifests = mergeManifests(manifests, written)
+		if len(manifests) == 0 {
+			return nil
+		}
+		c.logger.Info("Deleting", "object", util.GenerateObjectInfoString(obj), "from clusters", getManifestNamespaces(manifests))
+		deleteManifestsOnManagedClusters(c.logger, c.ocmClient, manifests)
 		return nil
 	}
 
@@ -435,23 +708,32 @@ func (c *Controller) reconcile(ctx context.Context, key util.Key) error {
 		clusters = pickSingleCluster(clusters)
 	}
 
-	if key.DeletedObject != nil {
-		c.logger.Info("Deleting", "object", util.GenerateObjectInfoString(obj), "from clusters", clusters)
-		deleteObjectOnManagedClusters(c.logger, c.ocmClient, *key.DeletedObject, clusters)
-		return nil
+	if c.objectFinalizer {
+		if err := c.ensureObjectFinalizer(ctx, key, obj); err != nil {
+			return err
+		}
+	}
+
+	// informers only cache the metadata used for matching, get the full object to deliver
+	obj, err = c.registry.GetObject(ctx, key.GvkKey, key.NamespacedName.Namespace, key.NamespacedName.Name)
+	if err != nil {
+		// if the object was deleted in the meantime, the delete event takes care of it
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
 	}
 
 	c.logger.Info("Delivering", "object", util.GenerateObjectInfoString(obj), "to clusters", clusters)
-	return c.deliverObjectToManagedClusters(obj, clusters, managedByPlacements, singletonStatus)
+	return c.deliverObjectToManagedClusters(key, withoutObjectFinalizer(obj), clusters, managedByPlacements, singletonStatus)
 }
 
 func (c *Controller) getObjectFromKey(key util.Key) (runtime.Object, error) {
-	pLister := c.listers[key.GvkKey]
-	if pLister == nil {
+	lister, ok := c.registry.GetLister(key.GvkKey)
+	if !ok {
 		utilruntime.HandleError(fmt.Errorf("could not get lister for key: %s", key.GvkKey))
 		return nil, nil
 	}
-	lister := *pLister
 
 	return getObject(lister, key.NamespacedName.Namespace, key.NamespacedName.Name)
 }
@@ -488,12 +770,10 @@ func isBeingDeleted(obj runtime.Object) bool {
 	return mObj.GetDeletionTimestamp() != nil
 }
 
-func (c *Controller) GetListers() map[string]*cache.GenericLister {
-	return c.listers
-}
-
-func (c *Controller) GetInformers() map[string]*cache.SharedIndexInformer {
-	return c.informers
+// GetInformerRegistry returns the registry of the informers started by this controller,
+// so that other controllers can share the same caches and track added and removed kinds
+func (c *Controller) GetInformerRegistry() *informers.Registry {
+	return c.registry
 }
 
 // sort by name and pick first cluster so that the choice is deterministic based on names
@@ -503,6 +783,7 @@ func pickSingleCluster(clusters []string) []string {
 }
 
 func (c *Controller) deliverObjectToManagedClusters(
+	key util.Key,
 	obj runtime.Object,
 	managedClusters, managedByPlacements []string,
 	singletonStatus bool) error {
@@ -510,32 +791,15 @@ func (c *Controller) deliverObjectToManagedClusters(
 		// find which placement(s) select this managedCluster
 		placementNames := []string{}
 		for _, plName := range managedByPlacements {
-			plObj, err := c.getPlacementByName(plName)
-			if err != nil {
-				return err
+			placement, ok := c.placements.get(plName)
+			if !ok {
+				return fmt.Errorf("placement %s not found", plName)
 			}
-			pl, err := runtimeObjectToPlacement(plObj)
+			clusters, err := c.getClustersForPlacement(placement)
 			if err != nil {
 				return err
 			}
-			cl, err := ocm.GetClusterByName(c.ocmClient, clName)
-			if err != nil {
-				return err
-			}
-			// a placement selects a managedCluster iff the managedCluster is selected by every single selector
-			// i.e. selectors are ANDed
-			matches := true
-			for _, s := range pl.Spec.ClusterSelectors {
-				selector, err := metav1.LabelSelectorAsSelector(&s)
-				if err != nil {
-					return err
-				}
-				if !selector.Matches(labels.Set(cl.Labels)) {
-					matches = false
-					break
-				}
-			}
-			if matches {
+			if clusters.Has(clName) {
 				placementNames = append(placementNames, plName)
 			}
 		}
@@ -543,11 +807,32 @@ func (c *Controller) deliverObjectToManagedClusters(
 			return nil
 		}
 		manifest := ocm.WrapObject(obj)
+		gvk := obj.GetObjectKind().GroupVersionKind()
+		if gvr, ok := c.registry.GetGVR(util.KeyForGroupVersionKind(gvk.Group, gvk.Version, gvk.Kind)); ok {
+			if c.statusFeedback {
+				ocm.SetStatusFeedbackRules(manifest, gvr, obj.(metav1.Object))
+			}
+			ocm.SetUpdateStrategy(manifest, gvr, obj.(metav1.Object), c.updateStrategy(obj.(metav1.Object), placementNames))
+		}
 		util.SetManagedByPlacementLabels(manifest, c.wdsName, placementNames, singletonStatus)
-		err := reconcileManifest(c.ocmClient, manifest, clName)
-		if err != nil {
-			c.logger.Error(err, "Error delivering object to mailbox")
+		if c.orphanOnDeletion(obj.(metav1.Object), placementNames) {
+			ocm.SetOrphanOnDeletion(manifest)
+		}
+		if err := ocm.SetManifestHash(manifest); err != nil {
+			return err
 		}
+		c.queueManifest(key, clName, manifest, placementNames)
 	}
 	return nil
 }
+
+// queueManifest queues the write of the ManifestWork to the mailbox, unless the cached
+// ManifestWork is up to date and no earlier write is pending or in flight, which would
+// overwrite it with superseded content. A pending write is replaced by this one.
+func (c *Controller) queueManifest(key util.Key, cluster string, manifest *workv1.ManifestWork, placementNames []string) {
+	if c.manifestUpToDate(manifest, cluster) && !c.delivery.has(cluster, manifest.Name) {
+		manifestApplies.WithLabelValues(applyResultSkipped).Inc()
+		return
+	}
+	c.delivery.add(key, cluster, manifest, placementNames)
+}
@@ -17,16 +17,14 @@ limitations under the License.
 package placement
 
 import (
-	"context"
-	"strings"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/watch"
-	"k8s.io/client-go/tools/cache"
+	"k8s.io/apimachinery/pkg/util/sets"
 
+	"github.com/kubestellar/kubestellar/api/edge/v1alpha1"
 	"github.com/kubestellar/kubestellar/pkg/util"
 )
 
@@ -44,141 +42,98 @@ type APIResource struct {
 
 // Handle CRDs should account for CRDs being added or deleted to start/stop new informers as needed
 func (c *Controller) handleCRD(obj runtime.Object) error {
-
-	toStartList, toStopList, err := c.checkAPIResourcesForUpdates()
-	if err != nil {
-		return err
-	}
-
-	go c.startInformersForNewAPIResources(toStartList)
-
-	for _, key := range toStopList {
-		c.logger.Info("API removed, stopping informer.", "key", key)
-		stopper := c.stoppers[key]
-		// close channel
-		close(stopper)
-		// remove entries for key
-		delete(c.informers, key)
-		delete(c.listers, key)
-		delete(c.stoppers, key)
-		delete(c.gvksMap, key)
-	}
-
-	return nil
+	return c.updateWatchedResources()
 }
 
 // checks what APIs need starting new informers or stopping informers.
 // Returns a list of APIResources for informers to start and a list of keys for infomers to stop
-func (c *Controller) checkAPIResourcesForUpdates() ([]APIResource, []string, error) {
+func (c *Controller) checkAPIResourcesForUpdates(selection resourceSelection) ([]APIResource, []string, error) {
 	toStart := []APIResource{}
 	toStop := []string{}
 
 	// tracking keys are used to detect what API resources have been removed
 	trackingKeys := map[string]bool{}
-	for k := range c.informers {
+	for _, k := range c.registry.Keys() {
 		trackingKeys[k] = true
 	}
 
-	// Get all the api resources in the cluster
-	apiResources, err := c.kubernetesClient.Discovery().ServerPreferredResources()
+	// Get all the api resources in the cluster that should be watched
+	apiResources, failedGroups, err := c.getAPIResourcesToWatch(selection)
 	if err != nil {
-		// ignore the error caused by a stale API service
-		if !strings.Contains(err.Error(), util.UnableToRetrieveCompleteAPIListError) {
-			return nil, nil, err
+		return nil, nil, err
+	}
+
+	for _, apiResource := range apiResources {
+		key := util.KeyForGroupVersionKind(apiResource.groupVersion.Group,
+			apiResource.groupVersion.Version, apiResource.resource.Kind)
+		if !c.registry.Has(key) {
+			toStart = append(toStart, apiResource)
 		}
+		// remove the key from tracking keys, what is left in the map at the end are
+		// keys to the informers that need to be stopped.
+		delete(trackingKeys, key)
 	}
 
-	// Loop through the api resources and create informers and listers for each of them
-	for _, group := range apiResources {
-		if _, excluded := excludedGroupVersions[group.GroupVersion]; excluded {
+	for k := range trackingKeys {
+		// the resources of groups whose discovery failed may still be served,
+		// keep their informers until the group is discovered again
+		if gvr, ok := c.registry.GetGVR(k); ok && failedGroups.Has(gvr.GroupVersion()) {
 			continue
 		}
+		toStop = append(toStop, k)
+	}
+	return toStart, toStop, nil
+}
+
+// returns the preferred version of the API resources in the cluster that support informers,
+// are not excluded by the resource filter of the controller and can be selected by placements.
+// The resources required by the controller itself are always returned.
+// Also returns the group versions whose discovery failed, e.g. because of a stale
+// aggregated API service: their resources are missing from the returned list.
+func (c *Controller) getAPIResourcesToWatch(selection resourceSelection) ([]APIResource, sets.Set[schema.GroupVersion], error) {
+	apiResources, err := c.kubernetesClient.Discovery().ServerPreferredResources()
+	failedGroups := failedDiscoveryGroups(err)
+	if err != nil && failedGroups == nil {
+		return nil, nil, err
+	}
+	c.recordDiscoveryFailures(failedGroups)
+
+	toWatch := []APIResource{}
+	for _, group := range apiResources {
 		gv, err := schema.ParseGroupVersion(group.GroupVersion)
 		if err != nil {
 			c.logger.Error(err, "Failed to parse a GroupVersion", "groupVersion", group.GroupVersion)
 			continue
 		}
 		for _, resource := range group.APIResources {
-			if _, excluded := excludedResourceNames[resource.Name]; excluded {
+			if !verbsSupportInformers(resource.Verbs) {
 				continue
 			}
-			informable := verbsSupportInformers(resource.Verbs)
-			if informable {
-				key := util.KeyForGroupVersionKind(gv.Group, gv.Version, resource.Kind)
-				if _, ok := c.informers[key]; !ok {
-					toStart = append(toStart, APIResource{
-						groupVersion: gv,
-						resource:     resource,
-					})
-				}
-				// remove the key from tracking keys, what is left in the map at the end are
-				// keys to the informers that need to be stopped.
-				delete(trackingKeys, key)
+			// placements and CRDs are required by the controller itself
+			if !isRequiredResource(gv, resource.Name) &&
+				(c.resourceFilter.IsExcluded(gv, resource.Name) || !selection.matches(gv.Group, resource.Name)) {
+				continue
 			}
+			toWatch = append(toWatch, APIResource{
+				groupVersion: gv,
+				resource:     resource,
+			})
 		}
 	}
+	return toWatch, failedGroups, nil
+}
 
-	for k := range trackingKeys {
-		toStop = append(toStop, k)
-	}
-	return toStart, toStop, nil
+func isRequiredResource(gv schema.GroupVersion, resource string) bool {
+	return (gv.Group == v1alpha1.GroupVersion.Group && resource == util.PlacementResource) ||
+		(gv.Group == CRDGroup && resource == "customresourcedefinitions")
 }
 
+// starts the informers for APIs added after startup or newly selected by placements.
+// Must be called with watchLock held.
 func (c *Controller) startInformersForNewAPIResources(toStartList []APIResource) {
 	for _, toStart := range toStartList {
-		c.logger.Info("New API added. Starting informer for:", "group", toStart.groupVersion.Group,
+		c.logger.Info("Starting informer for:", "group", toStart.groupVersion.Group,
 			"version", toStart.groupVersion, "kind", toStart.resource.Kind)
-
-		gvr := schema.GroupVersionResource{
-			Group:    toStart.groupVersion.Group,
-			Version:  toStart.groupVersion.Version,
-			Resource: toStart.resource.Name,
-		}
-
-		informer := cache.NewSharedIndexInformer(
-			&cache.ListWatch{
-				ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
-					return c.dynamicClient.Resource(gvr).List(context.TODO(), metav1.ListOptions{})
-				},
-				WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
-					return c.dynamicClient.Resource(gvr).Watch(context.TODO(), metav1.ListOptions{})
-				},
-			},
-			nil,
-			0, //Skip resync
-			cache.Indexers{},
-		)
-
-		// add the event handler functions (same as those used by the startup logic)
-		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-			AddFunc: c.handleObject,
-			UpdateFunc: func(old, new interface{}) {
-				if shouldSkipUpdate(old, new) {
-					return
-				}
-				c.handleObject(new)
-			},
-			DeleteFunc: func(obj interface{}) {
-				if shouldSkipDelete(obj) {
-					return
-				}
-				c.handleObject(obj)
-			},
-		})
-		key := util.KeyForGroupVersionKind(toStart.groupVersion.Group,
-			toStart.groupVersion.Version, toStart.resource.Kind)
-		c.informers[key] = &informer
-		c.gvksMap[key] = &gvr
-
-		// create and index the lister
-		lister := cache.NewGenericLister(informer.GetIndexer(), gvr.GroupResource())
-		c.listers[key] = &lister
-		stopper := make(chan struct{})
-		defer close(stopper)
-		c.stoppers[key] = stopper
-
-		go informer.Run(stopper)
+		c.startInformer(toStart)
 	}
-	// block
-	select {}
 }
@@ -0,0 +1,63 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubestellar/kubestellar/api/edge/v1alpha1"
+	"github.com/kubestellar/kubestellar/pkg/util"
+)
+
+// objectDeletionPolicy returns the deletion policy set by the annotation of the object, if valid
+func objectDeletionPolicy(obj metav1.Object) (v1alpha1.DeletionPolicy, bool) {
+	switch policy := v1alpha1.DeletionPolicy(obj.GetAnnotations()[util.AnnotationDeletionPolicyKey]); policy {
+	case v1alpha1.DeletionPolicyDelete, v1alpha1.DeletionPolicyOrphan:
+		return policy, true
+	}
+	return "", false
+}
+
+// orphanOnDeletion returns true if the object delivered on behalf of the placements is
+// left on the clusters when withdrawn: the annotation of the object rules, otherwise
+// Orphan wins over Delete among the placements
+func (c *Controller) orphanOnDeletion(obj metav1.Object, placementNames []string) bool {
+	if policy, ok := objectDeletionPolicy(obj); ok {
+		return policy == v1alpha1.DeletionPolicyOrphan
+	}
+	for _, name := range placementNames {
+		if placement, ok := c.placements.get(name); ok && placement.deletionPolicy == v1alpha1.DeletionPolicyOrphan {
+			return true
+		}
+	}
+	return false
+}
+
+// orphanOnWithdrawal returns true if the object wrapped in the ManifestWork must be left
+// on the cluster when withdrawn on behalf of a placement with the given policy. The
+// annotation of the wrapped object rules, as the policies may have changed since the
+// ManifestWork was delivered.
+func orphanOnWithdrawal(manifest workv1.ManifestWork, policy v1alpha1.DeletionPolicy) bool {
+	if obj, err := extractObjectFromManifest(manifest); err == nil {
+		if objPolicy, ok := objectDeletionPolicy((*obj).(metav1.Object)); ok {
+			return objPolicy == v1alpha1.DeletionPolicyOrphan
+		}
+	}
+	return policy == v1alpha1.DeletionPolicyOrphan
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubestellar/kubestellar/api/edge/v1alpha1"
+)
+
+func TestDeletionPolicy(t *testing.T) {
+	c := &Controller{placements: newPlacementIndex(logr.Discard())}
+	orphaning := newTestPlacement("orphaning", 1)
+	orphaning.Spec.DeletionPolicy = v1alpha1.DeletionPolicyOrphan
+	c.placements.update(orphaning)
+	c.placements.update(newTestPlacement("deleting", 1))
+
+	plain := &metav1.ObjectMeta{Name: "cm"}
+	annotated := &metav1.ObjectMeta{Name: "cm", Annotations: map[string]string{
+		"annotations.kubestellar.io/deletion-policy": "Delete"}}
+	for _, tc := range []struct {
+		name       string
+		obj        metav1.Object
+		placements []string
+		orphan     bool
+	}{
+		{"default", plain, []string{"deleting"}, false},
+		{"orphan wins", plain, []string{"deleting", "orphaning"}, true},
+		{"annotation rules", annotated, []string{"orphaning"}, false},
+	} {
+		if orphan := c.orphanOnDeletion(tc.obj, tc.placements); orphan != tc.orphan {
+			t.Errorf("%s: expected orphan %v, got %v", tc.name, tc.orphan, orphan)
+		}
+	}
+
+	orphanedCM := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm","namespace":"ns1",` +
+		`"annotations":{"annotations.kubestellar.io/deletion-policy":"Orphan"}}}`
+	plainCM := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm","namespace":"ns1"}}`
+	if !orphanOnWithdrawal(*newTestManifestWork("cm", "cluster1", nil, orphanedCM), v1alpha1.DeletionPolicyDelete) {
+		t.Errorf("expected the annotation of the wrapped object to orphan it")
+	}
+	if orphanOnWithdrawal(*newTestManifestWork("cm", "cluster1", nil, plainCM), "") {
+		t.Errorf("expected the wrapped object to be deleted by default")
+	}
+	if !orphanOnWithdrawal(*newTestManifestWork("cm", "cluster1", nil, plainCM), v1alpha1.DeletionPolicyOrphan) {
+		t.Errorf("expected the policy of the placement to orphan the wrapped object")
+	}
+}
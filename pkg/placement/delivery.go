@@ -0,0 +1,402 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	"github.com/kubestellar/kubestellar/pkg/util"
+)
+
+const (
+	// DefaultDeliveryQPS is the default rate of ManifestWork writes to the IMBS
+	DefaultDeliveryQPS = 50
+	// DefaultDeliveryBurst is the default burst of ManifestWork writes to the IMBS
+	DefaultDeliveryBurst = 300
+	// DefaultClusterDeliveryQPS is the default rate of ManifestWork writes to a mailbox
+	DefaultClusterDeliveryQPS = 10
+	// DefaultClusterDeliveryBurst is the default burst of ManifestWork writes to a mailbox
+	DefaultClusterDeliveryBurst = 50
+	// DefaultPlacementDeliveryQPS is the default rate of ManifestWork writes for a placement
+	DefaultPlacementDeliveryQPS = 25
+	// DefaultPlacementDeliveryBurst is the default burst of ManifestWork writes for a placement
+	DefaultPlacementDeliveryBurst = 150
+)
+
+// DeliveryLimits are the budgets of the ManifestWork writes to the IMBS: a global one,
+// one per cluster (i.e. mailbox) and one per placement. A rate that is not positive
+// means no limit.
+type DeliveryLimits struct {
+	QPS            float64
+	Burst          int
+	ClusterQPS     float64
+	ClusterBurst   int
+	PlacementQPS   float64
+	PlacementBurst int
+}
+
+// DefaultDeliveryLimits returns the default budgets of the ManifestWork writes
+func DefaultDeliveryLimits() DeliveryLimits {
+	return DeliveryLimits{
+		QPS:            DefaultDeliveryQPS,
+		Burst:          DefaultDeliveryBurst,
+		ClusterQPS:     DefaultClusterDeliveryQPS,
+		ClusterBurst:   DefaultClusterDeliveryBurst,
+		PlacementQPS:   DefaultPlacementDeliveryQPS,
+		PlacementBurst: DefaultPlacementDeliveryBurst,
+	}
+}
+
+func newLimiter(qps float64, burst int) *rate.Limiter {
+	if qps <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(qps), burst)
+}
+
+// delay returns how long to wait before the limiter has a token
+func delay(lim *rate.Limiter, now time.Time) time.Duration {
+	if lim.Limit() == rate.Inf {
+		return 0
+	}
+	tokens := lim.TokensAt(now)
+	if tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tokens) / float64(lim.Limit()) * float64(time.Second))
+}
+
+// deliveryWrite is the write of a ManifestWork to the mailbox of a cluster, on behalf
+// of the placements in its labels. The key of the wrapped object is requeued when the
+// write fails or is cancelled.
+type deliveryWrite struct {
+	key        util.Key
+	cluster    string
+	manifest   *workv1.ManifestWork
+	placements []string
+}
+
+// sameObject returns true if the write wraps the object with the given key
+func (w *deliveryWrite) sameObject(key util.Key) bool {
+	return w.key.GvkKey == key.GvkKey && w.key.NamespacedName == key.NamespacedName
+}
+
+// hasPlacement returns true if the write is on behalf of the placement
+func (w *deliveryWrite) hasPlacement(name string) bool {
+	for _, p := range w.placements {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// clusterQueue holds the pending writes to a mailbox, in FIFO order. A pending write is
+// replaced by a later write of the same ManifestWork, keeping its position.
+type clusterQueue struct {
+	order    []string
+	pending  map[string]*deliveryWrite
+	inFlight map[string]*deliveryWrite
+	limiter  *rate.Limiter
+}
+
+// deliveryQueue is the fair-queuing layer between the reconciliation of the objects and
+// the writes of ManifestWorks. The clusters with pending writes are served in round-robin
+// order, so that a placement selecting many clusters or a cluster with many objects does
+// not starve the others, and a write is dispatched only when the global, cluster and
+// placements token buckets allow it.
+type deliveryQueue struct {
+	lock              sync.Mutex
+	limits            DeliveryLimits
+	global            *rate.Limiter
+	clusters          map[string]*clusterQueue
+	placementLimiters map[string]*rate.Limiter
+	// clusters with pending writes, in round-robin order
+	ring []string
+	next int
+	// signals that writes were added or completed
+	wakeup chan struct{}
+	// broadcasts that writes completed, to the cancellations waiting for them
+	completed *sync.Cond
+	write     func(*deliveryWrite)
+}
+
+func newDeliveryQueue(limits DeliveryLimits, write func(*deliveryWrite)) *deliveryQueue {
+	d := &deliveryQueue{
+		limits:            limits,
+		global:            newLimiter(limits.QPS, limits.Burst),
+		clusters:          map[string]*clusterQueue{},
+		placementLimiters: map[string]*rate.Limiter{},
+		wakeup:            make(chan struct{}, 1),
+		write:             write,
+	}
+	d.completed = sync.NewCond(&d.lock)
+	return d
+}
+
+// add queues the write of the ManifestWork wrapping the object with the key to the
+// mailbox of the cluster
+func (d *deliveryQueue) add(key util.Key, cluster string, manifest *workv1.ManifestWork, placements []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	cq, ok := d.clusters[cluster]
+	if !ok {
+		cq = &clusterQueue{
+			pending:  map[string]*deliveryWrite{},
+			inFlight: map[string]*deliveryWrite{},
+			limiter:  newLimiter(d.limits.ClusterQPS, d.limits.ClusterBurst),
+		}
+		d.clusters[cluster] = cq
+	}
+	w := &deliveryWrite{key: key, cluster: cluster, manifest: manifest, placements: placements}
+	if _, ok := cq.pending[manifest.Name]; !ok {
+		if len(cq.order) == 0 {
+			d.ring = append(d.ring, cluster)
+		}
+		cq.order = append(cq.order, manifest.Name)
+	}
+	cq.pending[manifest.Name] = w
+	deliveryQueueDepth.WithLabelValues(cluster).Set(float64(len(cq.order)))
+	d.signal()
+}
+
+func (d *deliveryQueue) signal() {
+	select {
+	case d.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// must be called with the lock held
+func (d *deliveryQueue) placementLimiter(name string) *rate.Limiter {
+	lim, ok := d.placementLimiters[name]
+	if !ok {
+		lim = newLimiter(d.limits.PlacementQPS, d.limits.PlacementBurst)
+		d.placementLimiters[name] = lim
+	}
+	return lim
+}
+
+// pop returns the next write allowed by the token buckets, visiting the clusters with
+// pending writes in round-robin order. If no write is allowed, returns the time to wait
+// before one could be, or zero if there are no pending writes that can be dispatched.
+func (d *deliveryQueue) pop(now time.Time) (*deliveryWrite, time.Duration) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var wait time.Duration
+	for i := 0; i < len(d.ring); i++ {
+		idx := (d.next + i) % len(d.ring)
+		cluster := d.ring[idx]
+		cq := d.clusters[cluster]
+		name := cq.order[0]
+		// the writes of a ManifestWork are not reordered
+		if _, ok := cq.inFlight[name]; ok {
+			continue
+		}
+		w := cq.pending[name]
+		limiters := []*rate.Limiter{d.global, cq.limiter}
+		for _, p := range w.placements {
+			limiters = append(limiters, d.placementLimiter(p))
+		}
+		var blocked time.Duration
+		for _, lim := range limiters {
+			if dl := delay(lim, now); dl > blocked {
+				blocked = dl
+			}
+		}
+		if blocked > 0 {
+			if wait == 0 || blocked < wait {
+				wait = blocked
+			}
+			continue
+		}
+		for _, lim := range limiters {
+			lim.AllowN(now, 1)
+		}
+
+		cq.order = cq.order[1:]
+		delete(cq.pending, name)
+		cq.inFlight[name] = w
+		deliveryQueueDepth.WithLabelValues(cluster).Set(float64(len(cq.order)))
+		if len(cq.order) == 0 {
+			d.ring = append(d.ring[:idx], d.ring[idx+1:]...)
+			d.next = idx
+		} else {
+			d.next = idx + 1
+		}
+		return w, 0
+	}
+	return nil, wait
+}
+
+// done marks the write as completed
+func (d *deliveryQueue) done(w *deliveryWrite) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if cq, ok := d.clusters[w.cluster]; ok && cq.inFlight[w.manifest.Name] == w {
+		delete(cq.inFlight, w.manifest.Name)
+	}
+	d.completed.Broadcast()
+	d.signal()
+}
+
+// has returns true if a write of the ManifestWork to the mailbox of the cluster is
+// pending or in flight
+func (d *deliveryQueue) has(cluster, name string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	cq, ok := d.clusters[cluster]
+	if !ok {
+		return false
+	}
+	_, pending := cq.pending[name]
+	_, inFlight := cq.inFlight[name]
+	return pending || inFlight
+}
+
+// cancel drops the pending writes selected by the filter, and waits for the selected
+// writes in flight to complete, so that a withdrawal of ManifestWorks is not overtaken
+// by their delivery. Returns the dropped writes and the completed ones: the ManifestWorks
+// of the latter may exist in the mailboxes without being in the cache yet.
+func (d *deliveryQueue) cancel(selected func(*deliveryWrite) bool) (dropped, completed []*deliveryWrite) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for cluster, cq := range d.clusters {
+		order := cq.order[:0]
+		for _, name := range cq.order {
+			if w := cq.pending[name]; selected(w) {
+				dropped = append(dropped, w)
+				delete(cq.pending, name)
+				continue
+			}
+			order = append(order, name)
+		}
+		if len(order) == 0 && len(cq.order) > 0 {
+			d.removeFromRing(cluster)
+		}
+		cq.order = order
+		deliveryQueueDepth.WithLabelValues(cluster).Set(float64(len(cq.order)))
+		for _, w := range cq.inFlight {
+			if selected(w) {
+				completed = append(completed, w)
+			}
+		}
+	}
+	for _, w := range completed {
+		for d.inFlight(w) {
+			d.completed.Wait()
+		}
+	}
+	return dropped, completed
+}
+
+// must be called with the lock held
+func (d *deliveryQueue) inFlight(w *deliveryWrite) bool {
+	cq, ok := d.clusters[w.cluster]
+	return ok && cq.inFlight[w.manifest.Name] == w
+}
+
+// must be called with the lock held
+func (d *deliveryQueue) removeFromRing(cluster string) {
+	for i, name := range d.ring {
+		if name == cluster {
+			d.ring = append(d.ring[:i], d.ring[i+1:]...)
+			if d.next > i {
+				d.next--
+			}
+			return
+		}
+	}
+}
+
+// forgetCluster drops the pending writes and the token bucket of a removed cluster
+func (d *deliveryQueue) forgetCluster(cluster string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.clusters, cluster)
+	d.removeFromRing(cluster)
+	d.completed.Broadcast()
+	deliveryQueueDepth.DeleteLabelValues(cluster)
+}
+
+// forgetPlacement drops the token bucket of a removed placement
+func (d *deliveryQueue) forgetPlacement(name string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.placementLimiters, name)
+}
+
+// run dispatches the writes to the workers until the context is cancelled, then waits
+// for the writes in flight to complete. Pending writes are dropped, as all the objects
+// are reconciled again when the controller starts.
+func (d *deliveryQueue) run(ctx context.Context, workers int) {
+	writes := make(chan *deliveryWrite)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for w := range writes {
+				d.write(w)
+				d.done(w)
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(writes)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		w, wait := d.pop(time.Now())
+		if w != nil {
+			select {
+			case writes <- w:
+				continue
+			case <-ctx.Done():
+				// the write is not dispatched, so that nothing waits for it
+				d.done(w)
+				return
+			}
+		}
+		var timeout <-chan time.Time
+		if wait > 0 {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wakeup:
+		case <-timeout:
+		}
+	}
+}
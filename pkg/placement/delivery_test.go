@@ -0,0 +1,218 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kubestellar/kubestellar/pkg/ocm"
+	"github.com/kubestellar/kubestellar/pkg/util"
+)
+
+func newTestWork(name string) *workv1.ManifestWork {
+	return &workv1.ManifestWork{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+func popAll(d *deliveryQueue, now time.Time) []string {
+	popped := []string{}
+	for {
+		w, _ := d.pop(now)
+		if w == nil {
+			return popped
+		}
+		popped = append(popped, w.cluster+"/"+w.manifest.Name)
+		d.done(w)
+	}
+}
+
+func TestDeliveryQueueFairness(t *testing.T) {
+	d := newDeliveryQueue(DeliveryLimits{}, nil)
+	d.add(util.Key{}, "a", newTestWork("1"), []string{"p"})
+	d.add(util.Key{}, "a", newTestWork("2"), []string{"p"})
+	d.add(util.Key{}, "a", newTestWork("3"), []string{"p"})
+	d.add(util.Key{}, "b", newTestWork("1"), []string{"p"})
+	// a later write of a pending ManifestWork replaces it
+	d.add(util.Key{}, "a", newTestWork("2"), []string{"p", "q"})
+
+	popped := popAll(d, time.Now())
+	expected := []string{"a/1", "b/1", "a/2", "a/3"}
+	if len(popped) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, popped)
+	}
+	for i := range expected {
+		if popped[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, popped)
+		}
+	}
+}
+
+func TestDeliveryQueueLimits(t *testing.T) {
+	d := newDeliveryQueue(DeliveryLimits{ClusterQPS: 1, ClusterBurst: 1, PlacementQPS: 1, PlacementBurst: 2}, nil)
+	now := time.Now()
+	d.add(util.Key{}, "a", newTestWork("1"), []string{"p"})
+	d.add(util.Key{}, "a", newTestWork("2"), []string{"p"})
+	d.add(util.Key{}, "b", newTestWork("1"), []string{"p"})
+	d.add(util.Key{}, "c", newTestWork("1"), []string{"p"})
+
+	// one write per cluster, and two for the placement
+	popped := popAll(d, now)
+	if len(popped) != 2 || popped[0] != "a/1" || popped[1] != "b/1" {
+		t.Fatalf("expected [a/1 b/1], got %v", popped)
+	}
+	w, wait := d.pop(now)
+	if w != nil || wait <= 0 || wait > time.Second {
+		t.Fatalf("expected to wait for the budgets, got %v after %s", w, wait)
+	}
+	if popped := popAll(d, now.Add(time.Second)); len(popped) != 1 || popped[0] != "c/1" {
+		t.Errorf("expected [c/1] after a second, got %v", popped)
+	}
+}
+
+func TestDeliveryQueueInFlight(t *testing.T) {
+	d := newDeliveryQueue(DeliveryLimits{}, nil)
+	now := time.Now()
+	d.add(util.Key{}, "a", newTestWork("1"), nil)
+	first, _ := d.pop(now)
+	d.add(util.Key{}, "a", newTestWork("1"), nil)
+	// the second write of the ManifestWork waits for the first to complete
+	if w, _ := d.pop(now); w != nil {
+		t.Fatalf("expected no write while the previous one is in flight, got %s", w.manifest.Name)
+	}
+	d.done(first)
+	if w, _ := d.pop(now); w == nil {
+		t.Errorf("expected the write to be dispatched once the previous one completed")
+	}
+}
+
+func TestDeliveryQueueCancel(t *testing.T) {
+	d := newDeliveryQueue(DeliveryLimits{}, nil)
+	now := time.Now()
+	obj := util.Key{GvkKey: "v1/ConfigMap", NamespacedName: cache.ObjectName{Namespace: "ns", Name: "cm"}}
+	other := util.Key{GvkKey: "v1/ConfigMap", NamespacedName: cache.ObjectName{Namespace: "ns", Name: "other"}}
+	d.add(obj, "a", newTestWork("1"), nil)
+	d.add(obj, "b", newTestWork("1"), nil)
+	d.add(other, "b", newTestWork("2"), nil)
+	inFlight, _ := d.pop(now)
+
+	// the pending writes of the object are dropped, the one in flight is waited for
+	cancelled := make(chan struct{})
+	var dropped, completed []*deliveryWrite
+	go func() {
+		dropped, completed = d.cancel(func(w *deliveryWrite) bool { return w.sameObject(obj) })
+		close(cancelled)
+	}()
+	select {
+	case <-cancelled:
+		t.Fatalf("expected the cancellation to wait for the write in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+	d.done(inFlight)
+	<-cancelled
+	if len(dropped) != 1 || dropped[0].cluster != "b" || len(completed) != 1 || completed[0] != inFlight {
+		t.Fatalf("expected b/1 to be dropped and a/1 to be completed, got %v and %v", dropped, completed)
+	}
+	if popped := popAll(d, now); len(popped) != 1 || popped[0] != "b/2" {
+		t.Errorf("expected only the write of the other object to remain, got %v", popped)
+	}
+}
+
+func TestDeliveryQueueStopBeforeDispatch(t *testing.T) {
+	d := newDeliveryQueue(DeliveryLimits{}, nil)
+	obj := util.Key{GvkKey: "v1/ConfigMap", NamespacedName: cache.ObjectName{Namespace: "ns", Name: "cm"}}
+	d.add(obj, "a", newTestWork("1"), nil)
+
+	// without workers, the popped write is never sent
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		d.run(ctx, 0)
+		close(stopped)
+	}()
+	for len(pendingWrites(d)) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-stopped
+
+	cancelled := make(chan struct{})
+	go func() {
+		d.cancel(func(w *deliveryWrite) bool { return w.sameObject(obj) })
+		close(cancelled)
+	}()
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the cancellation not to wait for a write that was not dispatched")
+	}
+}
+
+// pendingWrites returns the names of the pending writes
+func pendingWrites(d *deliveryQueue) []string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	pending := []string{}
+	for _, cq := range d.clusters {
+		pending = append(pending, cq.order...)
+	}
+	return pending
+}
+
+func TestQueueManifestAfterRevert(t *testing.T) {
+	c := &Controller{
+		logger:   logr.Discard(),
+		delivery: newDeliveryQueue(DeliveryLimits{ClusterQPS: 0.001, ClusterBurst: 1}, nil),
+	}
+	c.manifestWorkInformer = cache.NewSharedIndexInformer(&cache.ListWatch{}, &workv1.ManifestWork{}, 0, cache.Indexers{})
+	obj := util.Key{GvkKey: "v1/ConfigMap", NamespacedName: cache.ObjectName{Namespace: "ns", Name: "cm"}}
+	version := func(v string) *workv1.ManifestWork {
+		manifest := newTestWork("cm")
+		manifest.Labels = map[string]string{"version": v}
+		if err := ocm.SetManifestHash(manifest); err != nil {
+			t.Fatal(err)
+		}
+		return manifest
+	}
+	delivered := version("a")
+	delivered.Namespace = "cluster1"
+	if err := c.manifestWorkInformer.GetIndexer().Add(delivered); err != nil {
+		t.Fatal(err)
+	}
+
+	// the edit is still waiting for the budget of the mailbox when it is reverted
+	c.queueManifest(obj, "cluster1", version("b"), nil)
+	c.queueManifest(obj, "cluster1", version("a"), nil)
+
+	w, _ := c.delivery.pop(time.Now())
+	if w == nil || w.manifest.Labels["version"] != "a" {
+		t.Fatalf("expected the reverted ManifestWork to replace the pending edit, got %v", w)
+	}
+	c.delivery.done(w)
+	// once nothing is pending, an up-to-date ManifestWork is not written
+	c.queueManifest(obj, "cluster1", version("a"), nil)
+	if c.delivery.has("cluster1", "cm") {
+		t.Errorf("expected no write of the up-to-date ManifestWork")
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/discovery"
+)
+
+// DefaultDiscoveryPeriod is the default period of the API discovery reconciliation
+const DefaultDiscoveryPeriod = time.Minute
+
+// runDiscovery periodically reconciles the informers with the API resources served by
+// the WDS. CRD events start and stop informers right away, the periodic discovery picks
+// up the APIs served by aggregated API services and retries the groups whose discovery
+// failed.
+func (c *Controller) runDiscovery(ctx context.Context) {
+	ticker := time.NewTicker(c.discoveryPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.updateWatchedResources(); err != nil {
+				c.logger.Error(err, "Failed to reconcile informers with API discovery")
+			}
+		}
+	}
+}
+
+// failedDiscoveryGroups returns the group versions whose discovery failed, or nil if
+// the error is not a partial discovery failure
+func failedDiscoveryGroups(err error) sets.Set[schema.GroupVersion] {
+	var groupErr *discovery.ErrGroupDiscoveryFailed
+	if err == nil || !errors.As(err, &groupErr) {
+		return nil
+	}
+	failed := sets.New[schema.GroupVersion]()
+	for gv := range groupErr.Groups {
+		failed.Insert(gv)
+	}
+	return failed
+}
+
+// recordDiscoveryFailures reports the group versions whose discovery failed in the metrics
+// and logs them when they change
+func (c *Controller) recordDiscoveryFailures(failed sets.Set[schema.GroupVersion]) {
+	c.discoveryLock.Lock()
+	defer c.discoveryLock.Unlock()
+	if failed.Equal(c.failedGroups) {
+		return
+	}
+	apiDiscoveryFailedGroups.Reset()
+	for gv := range failed {
+		apiDiscoveryFailedGroups.WithLabelValues(gv.String()).Set(1)
+	}
+	for gv := range failed.Difference(c.failedGroups) {
+		c.logger.Info("API discovery failed, will retry", "groupVersion", gv.String())
+	}
+	for gv := range c.failedGroups.Difference(failed) {
+		c.logger.Info("API discovery recovered", "groupVersion", gv.String())
+	}
+	c.failedGroups = failed
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+)
+
+func TestDiscoveryFailures(t *testing.T) {
+	metricsGV := schema.GroupVersion{Group: "metrics.k8s.io", Version: "v1beta1"}
+	err := &discovery.ErrGroupDiscoveryFailed{Groups: map[schema.GroupVersion]error{
+		metricsGV: fmt.Errorf("the server is currently unable to handle the request"),
+	}}
+
+	if failed := failedDiscoveryGroups(fmt.Errorf("connection refused")); failed != nil {
+		t.Errorf("expected other errors not to be partial failures, got %v", failed)
+	}
+	failed := failedDiscoveryGroups(err)
+	if failed.Len() != 1 || !failed.Has(metricsGV) {
+		t.Fatalf("expected %s to fail, got %v", metricsGV, failed)
+	}
+
+	c := &Controller{logger: logr.Discard()}
+	c.recordDiscoveryFailures(failed)
+	if value := testutil.ToFloat64(apiDiscoveryFailedGroups.WithLabelValues(metricsGV.String())); value != 1 {
+		t.Errorf("expected the failed group to be reported, got %v", value)
+	}
+	c.recordDiscoveryFailures(failedDiscoveryGroups(nil))
+	if count := testutil.CollectAndCount(apiDiscoveryFailedGroups); count != 0 {
+		t.Errorf("expected no failed groups after recovery, got %d", count)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Resources excluded by default from watchers as they should not delivered to other clusters.
+// Rules are in the form accepted by ParseResourceRule.
+var DefaultExcludedResources = []string{
+	"*.flowcontrol.apiserver.k8s.io",
+	"*.scheduling.k8s.io",
+	"*.discovery.k8s.io",
+	"*.apiregistration.k8s.io",
+	"*.coordination.k8s.io",
+	"events",
+	"events.events.k8s.io",
+	"nodes",
+	"endpoints",
+	"csistoragecapacities.storage.k8s.io",
+	"csinodes.storage.k8s.io",
+}
+
+// ResourceRule identifies API resources by group, resource name and optionally version.
+// An empty Version matches all versions, a Resource "*" matches all resources in the group.
+type ResourceRule struct {
+	Group    string
+	Version  string
+	Resource string
+}
+
+// ParseResourceRule parses a rule in the form `<resource>[.<group>][/<version>]`, e.g.
+// `events` for the core group events, `*.coordination.k8s.io` for all the resources in
+// a group, or `csinodes.storage.k8s.io/v1` for a single version. Since resource names do
+// not contain dots, the group is whatever follows the first dot.
+func ParseResourceRule(rule string) (ResourceRule, error) {
+	r := ResourceRule{}
+	rule = strings.TrimSpace(rule)
+	if rule == "" {
+		return r, fmt.Errorf("empty resource rule")
+	}
+	groupResource, version, hasVersion := strings.Cut(rule, "/")
+	if hasVersion {
+		if version == "" || strings.Contains(version, "/") {
+			return r, fmt.Errorf("invalid version in resource rule %q", rule)
+		}
+		r.Version = version
+	}
+	r.Resource, r.Group, _ = strings.Cut(groupResource, ".")
+	if r.Resource == "" {
+		return r, fmt.Errorf("missing resource in resource rule %q", rule)
+	}
+	return r, nil
+}
+
+// Matches returns true if the rule matches the resource in the given group version
+func (r ResourceRule) Matches(gv schema.GroupVersion, resource string) bool {
+	if r.Group != gv.Group {
+		return false
+	}
+	if r.Version != "" && r.Version != gv.Version {
+		return false
+	}
+	return r.Resource == "*" || r.Resource == resource
+}
+
+// ResourceFilter decides which API resources are watched by the controller. A resource is
+// excluded if it matches any of the Exclude rules and none of the Include rules, so that
+// Include rules can override exclusions, e.g. to watch a user-supplied CRD whose resource
+// name is the same as an excluded resource in a different group.
+type ResourceFilter struct {
+	Exclude []ResourceRule
+	Include []ResourceRule
+}
+
+// NewResourceFilter creates a filter from exclusion and inclusion rules in the form
+// accepted by ParseResourceRule
+func NewResourceFilter(exclude, include []string) (*ResourceFilter, error) {
+	filter := &ResourceFilter{}
+	for _, s := range exclude {
+		rule, err := ParseResourceRule(s)
+		if err != nil {
+			return nil, err
+		}
+		filter.Exclude = append(filter.Exclude, rule)
+	}
+	for _, s := range include {
+		rule, err := ParseResourceRule(s)
+		if err != nil {
+			return nil, err
+		}
+		filter.Include = append(filter.Include, rule)
+	}
+	return filter, nil
+}
+
+// IsExcluded returns true if the resource in the given group version should not be watched
+func (f *ResourceFilter) IsExcluded(gv schema.GroupVersion, resource string) bool {
+	if f == nil {
+		return false
+	}
+	excluded := false
+	for _, rule := range f.Exclude {
+		if rule.Matches(gv, resource) {
+			excluded = true
+			break
+		}
+	}
+	if !excluded {
+		return false
+	}
+	for _, rule := range f.Include {
+		if rule.Matches(gv, resource) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseResourceRule(t *testing.T) {
+	tests := map[string]ResourceRule{
+		"events":                     {Resource: "events"},
+		"events.events.k8s.io":       {Group: "events.k8s.io", Resource: "events"},
+		"*.coordination.k8s.io":      {Group: "coordination.k8s.io", Resource: "*"},
+		"csinodes.storage.k8s.io/v1": {Group: "storage.k8s.io", Version: "v1", Resource: "csinodes"},
+		" nodes/v1 ":                 {Version: "v1", Resource: "nodes"},
+		"flowschemas.flowcontrol.apiserver.k8s.io/v1beta3": {
+			Group: "flowcontrol.apiserver.k8s.io", Version: "v1beta3", Resource: "flowschemas"},
+	}
+	for s, expected := range tests {
+		rule, err := ParseResourceRule(s)
+		if err != nil {
+			t.Errorf("unexpected error parsing %q: %s", s, err)
+			continue
+		}
+		if rule != expected {
+			t.Errorf("parsing %q: expected %+v, got %+v", s, expected, rule)
+		}
+	}
+
+	for _, s := range []string{"", ".apps", "deployments.apps/", "deployments.apps/v1/v2"} {
+		if _, err := ParseResourceRule(s); err == nil {
+			t.Errorf("expected error parsing %q", s)
+		}
+	}
+}
+
+func TestResourceFilter(t *testing.T) {
+	filter, err := NewResourceFilter(DefaultExcludedResources, []string{"leases.coordination.k8s.io/v1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	tests := []struct {
+		gv       schema.GroupVersion
+		resource string
+		excluded bool
+	}{
+		{schema.GroupVersion{Version: "v1"}, "events", true},
+		{schema.GroupVersion{Version: "v1"}, "configmaps", false},
+		// a user-supplied CRD with the same name as an excluded core resource
+		{schema.GroupVersion{Group: "example.com", Version: "v1"}, "events", false},
+		{schema.GroupVersion{Group: "flowcontrol.apiserver.k8s.io", Version: "v1beta3"}, "flowschemas", true},
+		// include overrides
+		{schema.GroupVersion{Group: "coordination.k8s.io", Version: "v1"}, "leases", false},
+		{schema.GroupVersion{Group: "coordination.k8s.io", Version: "v2"}, "leases", true},
+	}
+	for _, test := range tests {
+		if excluded := filter.IsExcluded(test.gv, test.resource); excluded != test.excluded {
+			t.Errorf("%s %s: expected excluded=%t, got %t", test.gv, test.resource, test.excluded, excluded)
+		}
+	}
+}
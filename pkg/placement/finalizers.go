@@ -0,0 +1,158 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/kubestellar/kubestellar/pkg/util"
+)
+
+// ObjectFinalizer is added to the WDS objects delivered to clusters when the controller
+// is configured with Options.ObjectFinalizer. The ManifestWorks wrapping the object are
+// deleted before the finalizer is removed, so that the deletion of the object reaches the
+// clusters even if the controller was not running when the object was deleted.
+// The finalizer is removed from the objects of a kind that placements no longer select.
+// Before uninstalling the controller, remove the finalizer from the objects, e.g. with
+// kubectl patch <resource> <name> --type=json -p '[{"op":"remove","path":"/metadata/finalizers/<index>"}]',
+// otherwise they cannot be deleted.
+const ObjectFinalizer = "placement.kubestellar.io/manifestworks"
+
+// ensureObjectFinalizer adds the finalizer to an object about to be delivered
+func (c *Controller) ensureObjectFinalizer(ctx context.Context, key util.Key, obj runtime.Object) error {
+	mObj := obj.(metav1.Object)
+	if controllerutil.ContainsFinalizer(obj.(client.Object), ObjectFinalizer) {
+		return nil
+	}
+	// the object is in the informer cache and must not be modified
+	finalizers := append([]string{}, mObj.GetFinalizers()...)
+	finalizers = append(finalizers, ObjectFinalizer)
+	return c.patchObjectFinalizers(ctx, key, mObj, finalizers)
+}
+
+// finalizeObject cancels the pending deliveries of an object being deleted, deletes the
+// ManifestWorks wrapping it, found with the index of the ManifestWorks by wrapped object,
+// and then removes the finalizer.
+// Objects without the finalizer are left to the delete event.
+func (c *Controller) finalizeObject(ctx context.Context, key util.Key, obj runtime.Object) error {
+	mObj := obj.(metav1.Object)
+	if !controllerutil.ContainsFinalizer(obj.(client.Object), ObjectFinalizer) {
+		return nil
+	}
+	written := c.cancelObjectDeliveries(key)
+	manifests, err := c.listManifestsForObject(obj)
+	if err != nil {
+		return err
+	}
+	manifests = mergeManifests(manifests, written)
+	if len(manifests) > 0 {
+		c.logger.Info("Deleting", "object", util.GenerateObjectInfoString(obj), "from clusters", getManifestNamespaces(manifests))
+	}
+	for i := range manifests {
+		if err := deleteManifest(c.ocmClient, &manifests[i], false); err != nil {
+			return err
+		}
+	}
+	return c.patchObjectFinalizers(ctx, key, mObj, removeObjectFinalizer(mObj.GetFinalizers()))
+}
+
+// releaseObjectFinalizers removes the finalizer from the cached objects of a kind whose
+// informer is about to be stopped, as nothing would remove it afterwards. The objects
+// being deleted are finalized, the others are withdrawn by the placement cleanup.
+func (c *Controller) releaseObjectFinalizers(ctx context.Context, gvkKey string) error {
+	lister, ok := c.registry.GetLister(gvkKey)
+	if !ok {
+		return nil
+	}
+	objs, err := lister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	for _, obj := range objs {
+		if !controllerutil.ContainsFinalizer(obj.(client.Object), ObjectFinalizer) || !c.ownsObject(obj) {
+			continue
+		}
+		mObj := obj.(metav1.Object)
+		key := util.Key{
+			GvkKey:         gvkKey,
+			NamespacedName: cache.ObjectName{Namespace: mObj.GetNamespace(), Name: mObj.GetName()},
+		}
+		if isBeingDeleted(obj) {
+			err = c.finalizeObject(ctx, key, obj)
+		} else {
+			err = c.patchObjectFinalizers(ctx, key, mObj, removeObjectFinalizer(mObj.GetFinalizers()))
+		}
+		// the API resource may have been removed
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeObjectFinalizer(finalizers []string) []string {
+	remaining := []string{}
+	for _, f := range finalizers {
+		if f != ObjectFinalizer {
+			remaining = append(remaining, f)
+		}
+	}
+	return remaining
+}
+
+// updates the finalizers of the object with a merge patch, failing on conflicts as the
+// finalizers of other controllers are listed
+func (c *Controller) patchObjectFinalizers(ctx context.Context, key util.Key, mObj metav1.Object, finalizers []string) error {
+	gvr, ok := c.registry.GetGVR(key.GvkKey)
+	if !ok {
+		return fmt.Errorf("could not get the resource for key: %s", key.GvkKey)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"finalizers":      finalizers,
+			"resourceVersion": mObj.GetResourceVersion(),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.metadataClient.Resource(gvr).Namespace(mObj.GetNamespace()).Patch(ctx, mObj.GetName(),
+		types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// withoutObjectFinalizer returns the object to wrap in ManifestWorks, so that the
+// finalizer is not delivered to the clusters where nothing would remove it
+func withoutObjectFinalizer(obj runtime.Object) runtime.Object {
+	if !controllerutil.ContainsFinalizer(obj.(client.Object), ObjectFinalizer) {
+		return obj
+	}
+	obj = obj.DeepCopyObject()
+	controllerutil.RemoveFinalizer(obj.(client.Object), ObjectFinalizer)
+	return obj
+}
@@ -0,0 +1,221 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/kubestellar/kubestellar/pkg/informers"
+	"github.com/kubestellar/kubestellar/pkg/util"
+)
+
+func TestWithoutObjectFinalizer(t *testing.T) {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ConfigMap")
+	obj.SetName("cm")
+	obj.SetFinalizers([]string{"example.com/other", ObjectFinalizer})
+
+	delivered := withoutObjectFinalizer(obj).(*unstructured.Unstructured)
+	if f := delivered.GetFinalizers(); len(f) != 1 || f[0] != "example.com/other" {
+		t.Errorf("expected only the other finalizer to be delivered, got %v", f)
+	}
+	// the cached object is not modified
+	if f := obj.GetFinalizers(); len(f) != 2 {
+		t.Errorf("expected the object to keep its finalizers, got %v", f)
+	}
+	// objects without the finalizer are not copied
+	if withoutObjectFinalizer(delivered) != delivered {
+		t.Errorf("expected the object without the finalizer to be returned as is")
+	}
+}
+
+// addTestInformer registers in the registry an informer listing the objects
+func addTestInformer(t *testing.T, registry *informers.Registry, key string, gvr schema.GroupVersionResource,
+	objs ...unstructured.Unstructured) {
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			return &unstructured.UnstructuredList{Items: objs}, nil
+		},
+		WatchFunc: func(metav1.ListOptions) (watch.Interface, error) {
+			return watch.NewFake(), nil
+		},
+	}, &unstructured.Unstructured{}, 0, cache.Indexers{})
+	registry.Add(key, gvr, informer)
+	if !cache.WaitForCacheSync(context.Background().Done(), informer.HasSynced) {
+		t.Fatal("informer not synced")
+	}
+}
+
+var (
+	testDeploymentKey = util.KeyForGroupVersionKind("apps", "v1", "Deployment")
+	testDeploymentGVR = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+)
+
+func newTestDeployment(finalizers ...string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("apps/v1")
+	obj.SetKind("Deployment")
+	obj.SetNamespace("ns1")
+	obj.SetName("d")
+	obj.SetFinalizers(finalizers)
+	return obj
+}
+
+// newFinalizerTestController returns a controller whose WDS has the deployment, and whose
+// IMBS has ManifestWorks wrapping it in the mailboxes of the clusters
+func newFinalizerTestController(t *testing.T, deployment *unstructured.Unstructured, clusters ...string) *Controller {
+	c := &Controller{
+		wdsName:  "wds1",
+		logger:   logr.Discard(),
+		registry: informers.NewRegistry(nil),
+		delivery: newDeliveryQueue(DeliveryLimits{}, nil),
+	}
+	t.Cleanup(c.registry.Stop)
+	addTestInformer(t, c.registry, testDeploymentKey, testDeploymentGVR, *deployment)
+
+	scheme := metadatafake.NewTestScheme()
+	if err := metav1.AddMetaToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c.metadataClient = metadatafake.NewSimpleMetadataClient(scheme, &metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "d", Finalizers: deployment.GetFinalizers()},
+	})
+
+	c.manifestWorkInformer = cache.NewSharedIndexInformer(&cache.ListWatch{}, &workv1.ManifestWork{}, 0,
+		cache.Indexers{manifestsBySourceIndex: indexManifestWorkBySource})
+	workScheme := runtime.NewScheme()
+	if err := workv1.Install(workScheme); err != nil {
+		t.Fatal(err)
+	}
+	builder := fake.NewClientBuilder().WithScheme(workScheme)
+	raw := `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"d","namespace":"ns1"}}`
+	p1 := util.GenerateManagedByPlacementLabelKey("wds1", "p1")
+	for _, cluster := range clusters {
+		mw := newTestManifestWork("d", cluster, map[string]string{util.WDSLabelKey: "wds1", p1: "true"}, raw)
+		if err := c.manifestWorkInformer.GetIndexer().Add(mw); err != nil {
+			t.Fatal(err)
+		}
+		builder = builder.WithObjects(mw.DeepCopy())
+	}
+	c.ocmClient = builder.Build()
+	return c
+}
+
+func getTestFinalizers(t *testing.T, c *Controller) []string {
+	obj, err := c.metadataClient.Resource(testDeploymentGVR).Namespace("ns1").Get(context.Background(), "d", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return obj.GetFinalizers()
+}
+
+func countPatches(c *Controller) int {
+	patches := 0
+	for _, action := range c.metadataClient.(*metadatafake.FakeMetadataClient).Actions() {
+		if action.GetVerb() == "patch" {
+			patches++
+		}
+	}
+	return patches
+}
+
+func TestEnsureObjectFinalizer(t *testing.T) {
+	deployment := newTestDeployment("example.com/other")
+	c := newFinalizerTestController(t, deployment)
+	key := util.Key{GvkKey: testDeploymentKey, NamespacedName: cache.ObjectName{Namespace: "ns1", Name: "d"}}
+
+	if err := c.ensureObjectFinalizer(context.Background(), key, deployment); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if f := getTestFinalizers(t, c); len(f) != 2 || f[0] != "example.com/other" || f[1] != ObjectFinalizer {
+		t.Errorf("expected the finalizer to be added after the other one, got %v", f)
+	}
+	// the cached object is not modified
+	if len(deployment.GetFinalizers()) != 1 {
+		t.Errorf("expected the cached object to be left unchanged, got %v", deployment.GetFinalizers())
+	}
+
+	// an object that has the finalizer is not patched again
+	if err := c.ensureObjectFinalizer(context.Background(), key, newTestDeployment(ObjectFinalizer)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if patches := countPatches(c); patches != 1 {
+		t.Errorf("expected a single patch, got %d", patches)
+	}
+}
+
+func TestFinalizeObject(t *testing.T) {
+	deployment := newTestDeployment("example.com/other", ObjectFinalizer)
+	deployment.SetDeletionTimestamp(&metav1.Time{Time: time.Now()})
+	c := newFinalizerTestController(t, deployment, "cluster1", "cluster2")
+	key := util.Key{GvkKey: testDeploymentKey, NamespacedName: cache.ObjectName{Namespace: "ns1", Name: "d"}}
+
+	// the ManifestWorks must be deleted when the finalizer is removed
+	remaining := -1
+	c.metadataClient.(*metadatafake.FakeMetadataClient).PrependReactor("patch", "deployments",
+		func(clienttesting.Action) (bool, runtime.Object, error) {
+			list := &workv1.ManifestWorkList{}
+			if err := c.ocmClient.List(context.Background(), list); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			remaining = len(list.Items)
+			return false, nil, nil
+		})
+
+	if err := c.finalizeObject(context.Background(), key, deployment); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if remaining != 0 {
+		t.Errorf("expected the ManifestWorks to be deleted before the finalizer is removed, %d remained", remaining)
+	}
+	if f := getTestFinalizers(t, c); len(f) != 1 || f[0] != "example.com/other" {
+		t.Errorf("expected only the other finalizer to remain, got %v", f)
+	}
+}
+
+func TestReleaseObjectFinalizers(t *testing.T) {
+	c := newFinalizerTestController(t, newTestDeployment(ObjectFinalizer), "cluster1")
+
+	if err := c.releaseObjectFinalizers(context.Background(), testDeploymentKey); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if f := getTestFinalizers(t, c); len(f) != 0 {
+		t.Errorf("expected the finalizer to be removed, got %v", f)
+	}
+	// the objects not being deleted are withdrawn by the placement cleanup
+	list := &workv1.ManifestWorkList{}
+	if err := c.ocmClient.List(context.Background(), list); err != nil || len(list.Items) != 1 {
+		t.Errorf("expected the ManifestWork to be left, got %d (%v)", len(list.Items), err)
+	}
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubestellar/kubestellar/pkg/util"
+)
+
+const (
+	// DefaultGCPeriod is the default period of the garbage collection of ManifestWorks
+	DefaultGCPeriod = 10 * time.Minute
+	// DefaultGCQPS is the default rate of the deletions and updates of orphaned ManifestWorks
+	DefaultGCQPS = 5
+	// DefaultGCBurst is the default burst of the deletions and updates of orphaned ManifestWorks
+	DefaultGCBurst = 10
+
+	// ManifestWorks created recently are not collected, as the caches of the objects,
+	// placements and clusters may not have caught up with the writes yet
+	gcMinAge = time.Minute
+)
+
+// GCOptions configures the garbage collection of the ManifestWorks of this WDS whose
+// object no longer exists or is no longer selected for the cluster by the placements in
+// their labels, e.g. because of deletions while the controller was not running or of
+// placements whose finalizer was removed by hand.
+type GCOptions struct {
+	// Period of the collection, which also runs once when the controller starts.
+	// If not positive, the collection only runs when the controller starts.
+	Period time.Duration
+	// ReportOnly logs and counts the orphaned ManifestWorks without changing them
+	ReportOnly bool
+	// QPS and Burst limit the deletions and updates of orphaned ManifestWorks.
+	// A rate that is not positive means no limit.
+	QPS   float64
+	Burst int
+}
+
+// DefaultGCOptions returns the default configuration of the garbage collection
+func DefaultGCOptions() GCOptions {
+	return GCOptions{
+		Period: DefaultGCPeriod,
+		QPS:    DefaultGCQPS,
+		Burst:  DefaultGCBurst,
+	}
+}
+
+// runGC sweeps the ManifestWorks once, and then periodically until the context is cancelled
+func (c *Controller) runGC(ctx context.Context) {
+	c.collectGarbage(ctx)
+	if c.gc.Period <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.gc.Period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.collectGarbage(ctx)
+		}
+	}
+}
+
+// collectGarbage deletes the cached ManifestWorks that no placement in their labels
+// justifies any longer, and removes the labels of the other placements that no longer do
+func (c *Controller) collectGarbage(ctx context.Context) {
+	now := time.Now()
+	orphans := 0
+	for _, obj := range c.manifestWorkInformer.GetIndexer().List() {
+		if ctx.Err() != nil {
+			return
+		}
+		manifest := obj.(*workv1.ManifestWork)
+		if manifest.DeletionTimestamp != nil || now.Sub(manifest.CreationTimestamp.Time) < gcMinAge {
+			continue
+		}
+		stale, err := c.orphanedPlacements(manifest)
+		if err != nil {
+			c.logger.Error(err, "Error checking ManifestWork for garbage collection", "manifest", manifest.Name, "namespace", manifest.Namespace)
+			continue
+		}
+		if len(stale) == 0 {
+			continue
+		}
+		orphans++
+		if err := c.collectManifest(ctx, manifest.DeepCopy(), stale); err != nil {
+			c.logger.Error(err, "Error collecting orphaned ManifestWork", "manifest", manifest.Name, "namespace", manifest.Namespace)
+		}
+	}
+	c.logger.V(1).Info("Garbage collection of ManifestWorks done", "orphans", orphans, "reportOnly", c.gc.ReportOnly)
+}
+
+// orphanedPlacements returns the placements in the labels of the ManifestWork that no
+// longer justify it: deleted placements, and if the kind of the wrapped object is watched,
+// the placements that no longer select the object for the cluster. All of them if the
+// object no longer exists.
+func (c *Controller) orphanedPlacements(manifest *workv1.ManifestWork) ([]string, error) {
+	if len(manifest.Spec.Workload.Manifests) != 1 {
+		return nil, nil
+	}
+	source := &metav1.PartialObjectMetadata{}
+	if err := json.Unmarshal(manifest.Spec.Workload.Manifests[0].Raw, source); err != nil {
+		return nil, nil
+	}
+	// the ManifestWorks are collected by the replica reconciling the wrapped object
+	if !c.ownsObject(source) {
+		return nil, nil
+	}
+	placements := util.GetPlacementNamesFromLabels(manifest.Labels, c.wdsName)
+
+	stale := []string{}
+	current := []*compiledPlacement{}
+	for _, name := range placements {
+		if placement, ok := c.placements.get(name); ok {
+			current = append(current, placement)
+		} else {
+			stale = append(stale, name)
+		}
+	}
+
+	gvk := source.GroupVersionKind()
+	key := util.KeyForGroupVersionKind(gvk.Group, gvk.Version, gvk.Kind)
+	lister, ok := c.registry.GetLister(key)
+	if !ok {
+		// the kind is not watched, so only the deleted placements are known to be stale
+		return stale, nil
+	}
+	// an object missing from a cache that has not synced yet may still exist
+	if !c.registry.HasSynced(key) {
+		return nil, nil
+	}
+	obj, err := getObject(lister, source.GetNamespace(), source.GetName())
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return placements, nil
+		}
+		return nil, err
+	}
+	// objects being deleted are withdrawn by the reconciliation of their deletion
+	if isBeingDeleted(obj) {
+		return stale, nil
+	}
+
+	clusters, managedByPlacements, singletonStatus, err := c.matchSelectors(obj)
+	if err != nil {
+		return nil, err
+	}
+	if singletonStatus && len(clusters) > 0 {
+		clusters = pickSingleCluster(clusters)
+	}
+	cluster := getClusterNameFromManifest(*manifest)
+	if !sets.New(clusters...).Has(cluster) {
+		return placements, nil
+	}
+	for _, placement := range current {
+		if !SliceContains(managedByPlacements, placement.name) {
+			stale = append(stale, placement.name)
+			continue
+		}
+		selected, err := c.getClustersForPlacement(placement)
+		if err != nil {
+			return nil, err
+		}
+		if !selected.Has(cluster) {
+			stale = append(stale, placement.name)
+		}
+	}
+	return stale, nil
+}
+
+// collectManifest deletes the ManifestWork if all the placements in its labels are stale,
+// or removes the labels of the stale ones
+func (c *Controller) collectManifest(ctx context.Context, manifest *workv1.ManifestWork, stale []string) error {
+	remaining := len(util.GetPlacementNamesFromLabels(manifest.Labels, c.wdsName)) - len(stale)
+	if c.gc.ReportOnly {
+		c.logger.Info("Found orphaned ManifestWork", "manifest", manifest.Name, "namespace", manifest.Namespace,
+			"stale placements", stale, "remaining placements", remaining)
+		gcManifests.WithLabelValues(gcActionReported).Inc()
+		return nil
+	}
+	if err := c.gcLimiter.Wait(ctx); err != nil {
+		return err
+	}
+	c.cancelManifestDelivery(manifest.Namespace, manifest.Name)
+	if remaining <= 0 {
+		c.logger.Info("Deleting orphaned ManifestWork", "manifest", manifest.Name, "namespace", manifest.Namespace,
+			"stale placements", stale)
+		// the policies of the placements that still exist are honored, the ManifestWork
+		// carries the policy it was delivered with
+		orphan := orphanOnWithdrawal(*manifest, "")
+		for _, name := range stale {
+			if placement, ok := c.placements.get(name); ok && orphanOnWithdrawal(*manifest, placement.deletionPolicy) {
+				orphan = true
+			}
+		}
+		if err := deleteManifest(c.ocmClient, manifest, orphan); err != nil {
+			return err
+		}
+		gcManifests.WithLabelValues(gcActionDeleted).Inc()
+		return nil
+	}
+	c.logger.Info("Removing stale placements from ManifestWork", "manifest", manifest.Name, "namespace", manifest.Namespace,
+		"stale placements", stale)
+	for _, name := range stale {
+		delete(manifest.Labels, util.GenerateManagedByPlacementLabelKey(c.wdsName, name))
+	}
+	if err := c.ocmClient.Update(ctx, manifest, &client.UpdateOptions{}); err != nil {
+		return err
+	}
+	gcManifests.WithLabelValues(gcActionRelabeled).Inc()
+	return nil
+}
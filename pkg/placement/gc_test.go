@@ -0,0 +1,119 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kubestellar/kubestellar/pkg/informers"
+	"github.com/kubestellar/kubestellar/pkg/util"
+)
+
+func TestGarbageCollectionReportOnly(t *testing.T) {
+	c := &Controller{
+		wdsName:    "wds1",
+		logger:     logr.Discard(),
+		registry:   informers.NewRegistry(nil),
+		placements: newPlacementIndex(logr.Discard()),
+		gc:         GCOptions{ReportOnly: true},
+	}
+	c.placements.update(newTestPlacement("p2", 1))
+	c.manifestWorkInformer = cache.NewSharedIndexInformer(&cache.ListWatch{}, &workv1.ManifestWork{}, 0, cache.Indexers{})
+	indexer := c.manifestWorkInformer.GetIndexer()
+
+	deployment := `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"d","namespace":"ns1"}}`
+	p1 := util.GenerateManagedByPlacementLabelKey("wds1", "p1")
+	p2 := util.GenerateManagedByPlacementLabelKey("wds1", "p2")
+	old := metav1.NewTime(time.Now().Add(-time.Hour))
+	stale := newTestManifestWork("stale", "cluster1", map[string]string{util.WDSLabelKey: "wds1", p1: "true", p2: "true"}, deployment)
+	stale.CreationTimestamp = old
+	// recent ManifestWorks are not collected
+	recent := newTestManifestWork("recent", "cluster1", map[string]string{util.WDSLabelKey: "wds1", p1: "true"}, deployment)
+	recent.CreationTimestamp = metav1.Now()
+	for _, mw := range []*workv1.ManifestWork{stale, recent} {
+		if err := indexer.Add(mw); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the kind of the wrapped object is not watched, so only the deleted placement is stale
+	orphaned, err := c.orphanedPlacements(stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphaned) != 1 || orphaned[0] != "p1" {
+		t.Errorf("expected p1 to be stale, got %v", orphaned)
+	}
+
+	before := testutil.ToFloat64(gcManifests.WithLabelValues(gcActionReported))
+	c.collectGarbage(context.Background())
+	if reported := testutil.ToFloat64(gcManifests.WithLabelValues(gcActionReported)) - before; reported != 1 {
+		t.Errorf("expected 1 orphaned ManifestWork to be reported, got %v", reported)
+	}
+	if len(indexer.List()) != 2 {
+		t.Errorf("expected the ManifestWorks to be left in report-only mode")
+	}
+}
+
+func TestGarbageCollectionUnsyncedKind(t *testing.T) {
+	c := &Controller{
+		wdsName:    "wds1",
+		logger:     logr.Discard(),
+		registry:   informers.NewRegistry(nil),
+		placements: newPlacementIndex(logr.Discard()),
+	}
+	defer c.registry.Stop()
+	c.placements.update(newTestPlacement("p1", 1))
+	// the informer of the kind does not sync until the test ends
+	listed := make(chan struct{})
+	defer close(listed)
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListFunc: func(metav1.ListOptions) (runtime.Object, error) {
+			<-listed
+			return &unstructured.UnstructuredList{}, nil
+		},
+		WatchFunc: func(metav1.ListOptions) (watch.Interface, error) {
+			return watch.NewFake(), nil
+		},
+	}, &unstructured.Unstructured{}, 0, cache.Indexers{})
+	c.registry.Add(testDeploymentKey, testDeploymentGVR, informer)
+
+	deployment := `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"d","namespace":"ns1"}}`
+	p1 := util.GenerateManagedByPlacementLabelKey("wds1", "p1")
+	manifest := newTestManifestWork("d", "cluster1", map[string]string{util.WDSLabelKey: "wds1", p1: "true"}, deployment)
+
+	// the object is not in the cache, but may exist
+	orphaned, err := c.orphanedPlacements(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphaned) != 0 {
+		t.Errorf("expected no stale placement while the informer is not synced, got %v", orphaned)
+	}
+}
@@ -0,0 +1,424 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/go-logr/logr"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kubestellar/kubestellar/api/edge/v1alpha1"
+)
+
+// compiledTest is an ObjectTest with parsed label selectors
+type compiledTest struct {
+	apiGroup           *string
+	resources          sets.Set[string]
+	namespaces         sets.Set[string]
+	objectNames        sets.Set[string]
+	objectSelectors    []labels.Selector
+	namespaceSelectors []labels.Selector
+}
+
+// compiledTests is a list of tests, an object matches if it matches any of them
+type compiledTests []compiledTest
+
+// objectInfo is the information about an object used by the tests
+type objectInfo struct {
+	group     string
+	resource  string
+	namespace string
+	name      string
+	labels    map[string]string
+	// returns the labels of the namespace of the object, if found
+	namespaceLabels func() (map[string]string, bool)
+}
+
+// compiledPlacement is a placement with parsed selectors, for a given generation
+type compiledPlacement struct {
+	name                string
+	uid                 types.UID
+	generation          int64
+	wantSingletonStatus bool
+	deletionPolicy      v1alpha1.DeletionPolicy
+	applyOptions        *v1alpha1.ApplyOptions
+	downsync            compiledTests
+	clusterSelectors    []labels.Selector
+	// clusters selected by the placement, cached until the ManagedClusters change
+	clusters      sets.Set[string]
+	clustersValid bool
+}
+
+// indexKey identifies the objects selected by a test. "*" stands for any value.
+type indexKey struct {
+	group     string
+	resource  string
+	namespace string
+}
+
+// placementIndex holds the compiled placements, indexed by the group, resource and
+// namespace of the objects that their Downsync tests can select
+type placementIndex struct {
+	lock       sync.RWMutex
+	logger     logr.Logger
+	placements map[string]*compiledPlacement
+	index      map[indexKey]sets.Set[string]
+	// incremented when the ManagedClusters change, so that cluster sets computed
+	// concurrently with a change are not cached
+	clustersVersion int64
+	// tests of the previous and current generations of the placements changed since
+	// the objects they select were last requeued. Multiple changes are coalesced.
+	pendingRequeue map[string]compiledTests
+}
+
+func newPlacementIndex(logger logr.Logger) *placementIndex {
+	return &placementIndex{
+		logger:         logger,
+		placements:     map[string]*compiledPlacement{},
+		index:          map[indexKey]sets.Set[string]{},
+		pendingRequeue: map[string]compiledTests{},
+	}
+}
+
+// invalid selectors are compiled to selectors that match nothing
+func compileLabelSelectors(logger logr.Logger, selectors []metav1.LabelSelector) []labels.Selector {
+	compiled := make([]labels.Selector, 0, len(selectors))
+	for _, ls := range selectors {
+		sel, err := metav1.LabelSelectorAsSelector(&ls)
+		if err != nil {
+			logger.Info("Failed to convert LabelSelector to labels.Selector", "ls", ls, "err", err)
+			sel = labels.Nothing()
+		}
+		compiled = append(compiled, sel)
+	}
+	return compiled
+}
+
+func compileObjectTests(logger logr.Logger, tests []v1alpha1.ObjectTest) compiledTests {
+	compiled := make(compiledTests, 0, len(tests))
+	for _, test := range tests {
+		compiled = append(compiled, compiledTest{
+			apiGroup:           test.APIGroup,
+			resources:          sets.New(test.Resources...),
+			namespaces:         sets.New(test.Namespaces...),
+			objectNames:        sets.New(test.ObjectNames...),
+			objectSelectors:    compileLabelSelectors(logger, test.ObjectSelectors),
+			namespaceSelectors: compileLabelSelectors(logger, test.NamespaceSelectors),
+		})
+	}
+	return compiled
+}
+
+func compilePlacement(logger logr.Logger, placement *v1alpha1.Placement) *compiledPlacement {
+	return &compiledPlacement{
+		name:                placement.GetName(),
+		uid:                 placement.GetUID(),
+		generation:          placement.GetGeneration(),
+		wantSingletonStatus: placement.Spec.WantSingletonReportedState,
+		deletionPolicy:      placement.Spec.DeletionPolicy,
+		applyOptions:        placement.Spec.ApplyOptions.DeepCopy(),
+		downsync:            compileObjectTests(logger, placement.Spec.Downsync),
+		clusterSelectors:    compileLabelSelectors(logger, placement.Spec.ClusterSelectors),
+	}
+}
+
+// an empty set or a set containing "*" matches any value
+func matchesSet(set sets.Set[string], value string) bool {
+	return set.Len() == 0 || set.Has(anyValue) || set.Has(value)
+}
+
+// indexValues returns the values under which a test is indexed for a criterion
+func indexValues(set sets.Set[string]) []string {
+	if set.Len() == 0 || set.Has(anyValue) {
+		return []string{anyValue}
+	}
+	return sets.List(set)
+}
+
+func (t compiledTest) indexKeys() []indexKey {
+	group := anyValue
+	if t.apiGroup != nil {
+		group = *t.apiGroup
+	}
+	keys := []indexKey{}
+	for _, resource := range indexValues(t.resources) {
+		for _, namespace := range indexValues(t.namespaces) {
+			keys = append(keys, indexKey{group: group, resource: resource, namespace: namespace})
+		}
+	}
+	return keys
+}
+
+// selectsResource returns true if the test can select objects of the group and resource
+func (t compiledTest) selectsResource(group, resource string) bool {
+	return (t.apiGroup == nil || *t.apiGroup == group) && matchesSet(t.resources, resource)
+}
+
+func (t compiledTest) matches(obj objectInfo) bool {
+	if t.apiGroup != nil && *t.apiGroup != obj.group {
+		return false
+	}
+	if !matchesSet(t.resources, obj.resource) || !matchesSet(t.namespaces, obj.namespace) ||
+		!matchesSet(t.objectNames, obj.name) {
+		return false
+	}
+	if len(t.objectSelectors) > 0 && !selectorsMatchAny(t.objectSelectors, obj.labels) {
+		return false
+	}
+	if len(t.namespaceSelectors) > 0 {
+		nsLabels, found := obj.namespaceLabels()
+		if !found || !selectorsMatchAny(t.namespaceSelectors, nsLabels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (tests compiledTests) matches(obj objectInfo) bool {
+	for _, test := range tests {
+		if test.matches(obj) {
+			return true
+		}
+	}
+	return false
+}
+
+func selectorsMatchAny(selectors []labels.Selector, labelSet map[string]string) bool {
+	for _, sel := range selectors {
+		if sel.Matches(labels.Set(labelSet)) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectsCluster returns true if the cluster labels match all the cluster selectors
+func (p *compiledPlacement) selectsCluster(clusterLabels map[string]string) bool {
+	for _, sel := range p.clusterSelectors {
+		if !sel.Matches(labels.Set(clusterLabels)) {
+			return false
+		}
+	}
+	return true
+}
+
+// update compiles the placement, unless the compiled placement for the same generation is
+// already in the index, and updates the index
+func (x *placementIndex) update(placement *v1alpha1.Placement) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	name := placement.GetName()
+	pending := x.pendingRequeue[name]
+	if existing, ok := x.placements[name]; ok {
+		if existing.uid == placement.GetUID() && existing.generation == placement.GetGeneration() {
+			return
+		}
+		pending = append(pending, existing.downsync...)
+		x.removeLocked(name)
+	}
+	compiled := compilePlacement(x.logger, placement)
+	x.placements[name] = compiled
+	x.pendingRequeue[name] = append(pending, compiled.downsync...)
+	for _, test := range compiled.downsync {
+		for _, key := range test.indexKeys() {
+			names, ok := x.index[key]
+			if !ok {
+				names = sets.New[string]()
+				x.index[key] = names
+			}
+			names.Insert(name)
+		}
+	}
+}
+
+func (x *placementIndex) remove(name string) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	x.removeLocked(name)
+	delete(x.pendingRequeue, name)
+}
+
+// takePendingRequeue returns the tests of the previous and current generations of the
+// placement whose objects need to be requeued, and clears them
+func (x *placementIndex) takePendingRequeue(name string) compiledTests {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	tests := x.pendingRequeue[name]
+	delete(x.pendingRequeue, name)
+	return tests
+}
+
+// addPendingRequeue adds tests whose objects need to be requeued, e.g. after a failure
+func (x *placementIndex) addPendingRequeue(name string, tests compiledTests) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	if _, ok := x.placements[name]; ok {
+		x.pendingRequeue[name] = append(x.pendingRequeue[name], tests...)
+	}
+}
+
+func (x *placementIndex) removeLocked(name string) {
+	compiled, ok := x.placements[name]
+	if !ok {
+		return
+	}
+	for _, test := range compiled.downsync {
+		for _, key := range test.indexKeys() {
+			if names, ok := x.index[key]; ok {
+				names.Delete(name)
+				if names.Len() == 0 {
+					delete(x.index, key)
+				}
+			}
+		}
+	}
+	delete(x.placements, name)
+}
+
+// get returns the compiled placement with the given name
+func (x *placementIndex) get(name string) (*compiledPlacement, bool) {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	compiled, ok := x.placements[name]
+	return compiled, ok
+}
+
+// lookup returns, sorted by name, the placements with tests that can select objects
+// of the group and resource in the namespace
+func (x *placementIndex) lookup(group, resource, namespace string) []*compiledPlacement {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	names := sets.New[string]()
+	for _, g := range []string{group, anyValue} {
+		for _, r := range []string{resource, anyValue} {
+			for _, ns := range []string{namespace, anyValue} {
+				if found, ok := x.index[indexKey{group: g, resource: r, namespace: ns}]; ok {
+					names = names.Union(found)
+				}
+			}
+		}
+	}
+	list := make([]*compiledPlacement, 0, names.Len())
+	for name := range names {
+		list = append(list, x.placements[name])
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+	return list
+}
+
+// getClusters returns the clusters selected by the placement from the cache, or computes
+// them with listClusters when the ManagedClusters changed since they were cached
+func (x *placementIndex) getClusters(p *compiledPlacement,
+	listClusters func(p *compiledPlacement) (sets.Set[string], error)) (sets.Set[string], error) {
+	x.lock.RLock()
+	clusters, valid, version := p.clusters, p.clustersValid, x.clustersVersion
+	x.lock.RUnlock()
+	if valid {
+		return clusters, nil
+	}
+
+	clusters, err := listClusters(p)
+	if err != nil {
+		return nil, err
+	}
+	x.lock.Lock()
+	if version == x.clustersVersion {
+		p.clusters, p.clustersValid = clusters, true
+	}
+	x.lock.Unlock()
+	return clusters, nil
+}
+
+// affectedByClusterChange returns the placements whose selection of a cluster changes
+// when its labels change from the old to the new ones. A cluster that did not exist or
+// no longer exists is selected by no placement.
+func (x *placementIndex) affectedByClusterChange(oldLabels map[string]string, oldExists bool,
+	newLabels map[string]string, newExists bool) []*compiledPlacement {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	affected := []*compiledPlacement{}
+	for _, p := range x.placements {
+		if (oldExists && p.selectsCluster(oldLabels)) != (newExists && p.selectsCluster(newLabels)) {
+			affected = append(affected, p)
+		}
+	}
+	return affected
+}
+
+// affectedByNamespaceChange returns the placements with a NamespaceSelector whose
+// selection of a namespace changes when its labels change from the old to the new ones
+func (x *placementIndex) affectedByNamespaceChange(oldLabels, newLabels map[string]string) []*compiledPlacement {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	affected := []*compiledPlacement{}
+	for _, p := range x.placements {
+		for _, test := range p.downsync {
+			if len(test.namespaceSelectors) > 0 &&
+				selectorsMatchAny(test.namespaceSelectors, oldLabels) != selectorsMatchAny(test.namespaceSelectors, newLabels) {
+				affected = append(affected, p)
+				break
+			}
+		}
+	}
+	return affected
+}
+
+// invalidateClusters drops the cached cluster sets, it is invoked when ManagedClusters change
+func (x *placementIndex) invalidateClusters() {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	x.clustersVersion++
+	for _, p := range x.placements {
+		p.clusters, p.clustersValid = nil, false
+	}
+}
+
+// eventHandler keeps the index in sync with the placements informer
+func (x *placementIndex) eventHandler() cache.ResourceEventHandler {
+	update := func(obj interface{}) {
+		placement, err := runtimeObjectToPlacement(obj.(runtime.Object))
+		if err != nil {
+			x.logger.Error(err, "Failed to index placement")
+			return
+		}
+		x.update(placement)
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: update,
+		UpdateFunc: func(_, new interface{}) {
+			update(new)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if mObj, ok := obj.(metav1.Object); ok {
+				x.remove(mObj.GetName())
+			}
+		},
+	}
+}
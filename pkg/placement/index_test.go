@@ -0,0 +1,202 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/kubestellar/kubestellar/api/edge/v1alpha1"
+)
+
+func newTestPlacement(name string, generation int64, tests ...v1alpha1.ObjectTest) *v1alpha1.Placement {
+	return &v1alpha1.Placement{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Generation: generation},
+		Spec:       v1alpha1.PlacementSpec{Downsync: tests},
+	}
+}
+
+func lookupNames(x *placementIndex, group, resource, namespace string) []string {
+	names := []string{}
+	for _, p := range x.lookup(group, resource, namespace) {
+		names = append(names, p.name)
+	}
+	return names
+}
+
+func TestPlacementIndex(t *testing.T) {
+	apps := "apps"
+	core := ""
+	x := newPlacementIndex(logr.Discard())
+	x.update(newTestPlacement("deployments-in-ns1", 1,
+		v1alpha1.ObjectTest{APIGroup: &apps, Resources: []string{"deployments"}, Namespaces: []string{"ns1"}}))
+	x.update(newTestPlacement("core", 1, v1alpha1.ObjectTest{APIGroup: &core}))
+	x.update(newTestPlacement("labeled", 1, v1alpha1.ObjectTest{
+		ObjectSelectors: []metav1.LabelSelector{{MatchLabels: map[string]string{"app": "a"}}}}))
+
+	tests := []struct {
+		group, resource, namespace string
+		expected                   []string
+	}{
+		{"apps", "deployments", "ns1", []string{"deployments-in-ns1", "labeled"}},
+		{"apps", "deployments", "ns2", []string{"labeled"}},
+		{"", "configmaps", "ns1", []string{"core", "labeled"}},
+	}
+	for _, test := range tests {
+		names := lookupNames(x, test.group, test.resource, test.namespace)
+		if !sets.New(names...).Equal(sets.New(test.expected...)) {
+			t.Errorf("%s/%s in %s: expected %v, got %v", test.group, test.resource, test.namespace, test.expected, names)
+		}
+	}
+
+	// the tests are evaluated on the candidates
+	labeled, _ := x.get("labeled")
+	info := objectInfo{group: "apps", resource: "deployments", namespace: "ns2", name: "d",
+		labels: map[string]string{"app": "b"}}
+	if labeled.downsync.matches(info) {
+		t.Errorf("expected object with different labels not to match")
+	}
+	info.labels["app"] = "a"
+	if !labeled.downsync.matches(info) {
+		t.Errorf("expected object with matching labels to match")
+	}
+
+	// a new generation replaces the index entries
+	x.update(newTestPlacement("deployments-in-ns1", 2,
+		v1alpha1.ObjectTest{APIGroup: &apps, Resources: []string{"statefulsets"}}))
+	if names := lookupNames(x, "apps", "deployments", "ns1"); len(names) != 1 || names[0] != "labeled" {
+		t.Errorf("expected only labeled after update, got %v", names)
+	}
+
+	x.remove("labeled")
+	if names := lookupNames(x, "apps", "deployments", "ns1"); len(names) != 0 {
+		t.Errorf("expected no placements after removal, got %v", names)
+	}
+}
+
+func TestPlacementIndexClusters(t *testing.T) {
+	x := newPlacementIndex(logr.Discard())
+	x.update(newTestPlacement("p", 1, v1alpha1.ObjectTest{}))
+	p, _ := x.get("p")
+
+	calls := 0
+	listClusters := func(p *compiledPlacement) (sets.Set[string], error) {
+		calls++
+		return sets.New("cluster1"), nil
+	}
+	for i := 0; i < 2; i++ {
+		clusters, err := x.getClusters(p, listClusters)
+		if err != nil || !clusters.Has("cluster1") {
+			t.Fatalf("unexpected clusters %v, err %v", clusters, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected clusters to be listed once, got %d", calls)
+	}
+
+	x.invalidateClusters()
+	if _, err := x.getClusters(p, listClusters); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected clusters to be listed again after invalidation, got %d", calls)
+	}
+}
+
+func TestPlacementIndexPendingRequeue(t *testing.T) {
+	apps := "apps"
+	x := newPlacementIndex(logr.Discard())
+	x.update(newTestPlacement("p", 1, v1alpha1.ObjectTest{APIGroup: &apps, Resources: []string{"deployments"}}))
+	x.update(newTestPlacement("p", 2, v1alpha1.ObjectTest{APIGroup: &apps, Resources: []string{"statefulsets"}}))
+	// same generation, e.g. a status update, is not requeued again
+	x.update(newTestPlacement("p", 2, v1alpha1.ObjectTest{APIGroup: &apps, Resources: []string{"statefulsets"}}))
+
+	// the two edits are coalesced, with the tests of both generations
+	tests := x.takePendingRequeue("p")
+	for _, resource := range []string{"deployments", "statefulsets"} {
+		selected := false
+		for _, test := range tests {
+			selected = selected || test.selectsResource("apps", resource)
+		}
+		if !selected {
+			t.Errorf("expected %s to be requeued", resource)
+		}
+	}
+	if tests := x.takePendingRequeue("p"); len(tests) != 0 {
+		t.Errorf("expected no pending requeue, got %d tests", len(tests))
+	}
+}
+
+func TestPlacementIndexAffectedByClusterChange(t *testing.T) {
+	x := newPlacementIndex(logr.Discard())
+	prod := newTestPlacement("prod", 1, v1alpha1.ObjectTest{})
+	prod.Spec.ClusterSelectors = []metav1.LabelSelector{{MatchLabels: map[string]string{"env": "prod"}}}
+	x.update(prod)
+	x.update(newTestPlacement("all", 1, v1alpha1.ObjectTest{}))
+
+	names := func(list []*compiledPlacement) sets.Set[string] {
+		s := sets.New[string]()
+		for _, p := range list {
+			s.Insert(p.name)
+		}
+		return s
+	}
+	prodLabels := map[string]string{"env": "prod"}
+	devLabels := map[string]string{"env": "dev"}
+
+	if affected := names(x.affectedByClusterChange(nil, false, devLabels, true)); !affected.Equal(sets.New("all")) {
+		t.Errorf("join: expected [all], got %v", sets.List(affected))
+	}
+	if affected := names(x.affectedByClusterChange(devLabels, true, prodLabels, true)); !affected.Equal(sets.New("prod")) {
+		t.Errorf("label change: expected [prod], got %v", sets.List(affected))
+	}
+	if affected := names(x.affectedByClusterChange(prodLabels, true, nil, false)); !affected.Equal(sets.New("all", "prod")) {
+		t.Errorf("removal: expected [all prod], got %v", sets.List(affected))
+	}
+}
+
+func TestPlacementIndexAffectedByNamespaceChange(t *testing.T) {
+	x := newPlacementIndex(logr.Discard())
+	x.update(newTestPlacement("prod", 1, v1alpha1.ObjectTest{
+		NamespaceSelectors: []metav1.LabelSelector{{MatchLabels: map[string]string{"env": "prod"}}},
+	}))
+	x.update(newTestPlacement("all", 1, v1alpha1.ObjectTest{}))
+
+	prodLabels := map[string]string{"env": "prod"}
+	devLabels := map[string]string{"env": "dev"}
+	for _, change := range []struct {
+		name     string
+		old, new map[string]string
+		expected []string
+	}{
+		{"starts matching", devLabels, prodLabels, []string{"prod"}},
+		{"stops matching", prodLabels, devLabels, []string{"prod"}},
+		{"unrelated change", devLabels, map[string]string{"env": "dev", "team": "a"}, []string{}},
+	} {
+		names := []string{}
+		for _, p := range x.affectedByNamespaceChange(change.old, change.new) {
+			names = append(names, p.name)
+		}
+		if !sets.New(names...).Equal(sets.New(change.expected...)) {
+			t.Errorf("%s: expected %v, got %v", change.name, change.expected, names)
+		}
+	}
+}
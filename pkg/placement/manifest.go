@@ -22,17 +22,16 @@ import (
 	"github.com/go-logr/logr"
 	workv1 "open-cluster-management.io/api/work/v1"
 
-	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/kubestellar/kubestellar/pkg/ocm"
 )
 
-func deleteObjectOnManagedClusters(logger logr.Logger, cl client.Client, obj runtime.Object, managedClusters []string) {
-	for _, managedCluster := range managedClusters {
-		err := deleteManifestForObject(cl, obj, managedCluster)
-		if err != nil {
-			logger.Error(err, "Error deleting object on mailbox")
+func deleteManifestsOnManagedClusters(logger logr.Logger, cl client.Client, manifests []workv1.ManifestWork) {
+	for i := range manifests {
+		if err := deleteManifest(cl, &manifests[i], false); err != nil {
+			logger.Error(err, "Error deleting object on mailbox", "manifest", manifests[i].Name, "namespace", manifests[i].Namespace)
 		}
 	}
 }
@@ -51,11 +50,64 @@ func reconcileManifest(cl client.Client, manifest *workv1.ManifestWork, namespac
 	return nil
 }
 
-func deleteManifestForObject(cl client.Client, obj runtime.Object, namespace string) error {
-	manifest := ocm.BuildEmptyManifestFromObject(obj)
-	manifest.SetNamespace(namespace)
+// deleteManifest deletes the ManifestWork, which deletes the wrapped object from the cluster
+// unless the ManifestWork was delivered to orphan it. With orphan true, the ManifestWork is
+// first changed to orphan the object, as the deletion policy may have changed since the
+// ManifestWork was delivered.
+func deleteManifest(cl client.Client, manifest *workv1.ManifestWork, orphan bool) error {
+	if orphan && !ocm.IsOrphanOnDeletion(manifest) {
+		patch := client.MergeFrom(manifest.DeepCopy())
+		ocm.SetOrphanOnDeletion(manifest)
+		if err := cl.Patch(context.TODO(), manifest, patch); err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			return err
+		}
+	}
 	if err := cl.Delete(context.TODO(), manifest, &client.DeleteOptions{}); err != nil {
+		// can ignore as it could be already deleted by another thread
+		if errors.IsNotFound(err) {
+			return nil
+		}
 		return err
 	}
 	return nil
 }
+
+// writtenManifests returns the ManifestWorks of completed writes
+func writtenManifests(writes []*deliveryWrite) []workv1.ManifestWork {
+	manifests := make([]workv1.ManifestWork, 0, len(writes))
+	for _, w := range writes {
+		manifest := w.manifest.DeepCopy()
+		manifest.SetNamespace(w.cluster)
+		manifests = append(manifests, *manifest)
+	}
+	return manifests
+}
+
+// mergeManifests adds to the cached ManifestWorks the written ones that are not cached yet
+func mergeManifests(cached, written []workv1.ManifestWork) []workv1.ManifestWork {
+	for _, manifest := range written {
+		found := false
+		for _, m := range cached {
+			if m.Namespace == manifest.Namespace && m.Name == manifest.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			cached = append(cached, manifest)
+		}
+	}
+	return cached
+}
+
+// getManifestNamespaces returns the namespaces, i.e. the mailboxes of the clusters, of the manifests
+func getManifestNamespaces(manifests []workv1.ManifestWork) []string {
+	namespaces := make([]string, 0, len(manifests))
+	for _, manifest := range manifests {
+		namespaces = append(namespaces, manifest.Namespace)
+	}
+	return namespaces
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	workclientset "open-cluster-management.io/api/client/work/clientset/versioned"
+	workinformers "open-cluster-management.io/api/client/work/informers/externalversions/work/v1"
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kubestellar/kubestellar/pkg/ocm"
+	"github.com/kubestellar/kubestellar/pkg/util"
+)
+
+const (
+	// indexes the ManifestWorks by the names of the placements in their managed-by labels
+	manifestsByPlacementIndex = "byPlacement"
+	// indexes the ManifestWorks by the wrapped object, see sourceObjectKey
+	manifestsBySourceIndex = "bySource"
+)
+
+// the ManifestWorks of this WDS in all the mailbox namespaces are cached, so that
+// they can be found by placement and by wrapped object without listing the IMBS
+func (c *Controller) newManifestWorkInformer(imbsRestConfig *rest.Config) (cache.SharedIndexInformer, error) {
+	workClient, err := workclientset.NewForConfig(imbsRestConfig)
+	if err != nil {
+		return nil, err
+	}
+	selector := util.SelectorForWDS(c.wdsName).String()
+	informer := workinformers.NewFilteredManifestWorkInformer(workClient, metav1.NamespaceAll, 0*time.Minute,
+		cache.Indexers{
+			manifestsByPlacementIndex: c.indexManifestWorkByPlacement,
+			manifestsBySourceIndex:    indexManifestWorkBySource,
+		},
+		func(options *metav1.ListOptions) {
+			options.LabelSelector = selector
+		})
+	informer.SetTransform(c.dropFields)
+	return informer, nil
+}
+
+func (c *Controller) indexManifestWorkByPlacement(obj interface{}) ([]string, error) {
+	mObj, ok := obj.(metav1.Object)
+	if !ok {
+		return nil, fmt.Errorf("object is not a metav1.Object: %T", obj)
+	}
+	return util.GetPlacementNamesFromLabels(mObj.GetLabels(), c.wdsName), nil
+}
+
+func indexManifestWorkBySource(obj interface{}) ([]string, error) {
+	manifest, ok := obj.(*workv1.ManifestWork)
+	if !ok {
+		return nil, fmt.Errorf("object is not a *workv1.ManifestWork: %T", obj)
+	}
+	keys := []string{}
+	for _, m := range manifest.Spec.Workload.Manifests {
+		// only the identity of the wrapped object is decoded
+		wrapped := &metav1.PartialObjectMetadata{}
+		if err := json.Unmarshal(m.Raw, wrapped); err != nil {
+			continue
+		}
+		gvk := wrapped.GroupVersionKind()
+		keys = append(keys, sourceObjectKey(gvk, wrapped.GetNamespace(), wrapped.GetName()))
+	}
+	return keys, nil
+}
+
+// sourceObjectKey identifies a WDS object wrapped in ManifestWorks
+func sourceObjectKey(gvk schema.GroupVersionKind, namespace, name string) string {
+	return util.KeyForGroupVersionKind(gvk.Group, gvk.Version, gvk.Kind) + "/" + namespace + "/" + name
+}
+
+// listManifestsForPlacement returns copies of the ManifestWorks managed by the placement
+func (c *Controller) listManifestsForPlacement(name string) ([]workv1.ManifestWork, error) {
+	return c.listManifestsByIndex(manifestsByPlacementIndex, name)
+}
+
+// listManifestsForObject returns copies of the ManifestWorks wrapping the object
+func (c *Controller) listManifestsForObject(obj runtime.Object) ([]workv1.ManifestWork, error) {
+	mObj := obj.(metav1.Object)
+	key := sourceObjectKey(obj.GetObjectKind().GroupVersionKind(), mObj.GetNamespace(), mObj.GetName())
+	return c.listManifestsByIndex(manifestsBySourceIndex, key)
+}
+
+// the returned ManifestWorks are sorted by namespace and name
+func (c *Controller) listManifestsByIndex(indexName, key string) ([]workv1.ManifestWork, error) {
+	objs, err := c.manifestWorkInformer.GetIndexer().ByIndex(indexName, key)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]workv1.ManifestWork, 0, len(objs))
+	for _, obj := range objs {
+		list = append(list, *obj.(*workv1.ManifestWork).DeepCopy())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Namespace != list[j].Namespace {
+			return list[i].Namespace < list[j].Namespace
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+// manifestUpToDate returns true if the cached ManifestWork in the mailbox namespace
+// carries the content hash of the desired one, in which case applying it is a no-op.
+// Changes made to the ManifestWork by others are not reverted until its content changes.
+func (c *Controller) manifestUpToDate(manifest *workv1.ManifestWork, namespace string) bool {
+	obj, exists, err := c.manifestWorkInformer.GetIndexer().GetByKey(namespace + "/" + manifest.Name)
+	if err != nil || !exists {
+		return false
+	}
+	cached := obj.(*workv1.ManifestWork)
+	return cached.DeletionTimestamp == nil && ocm.ManifestHashEqual(cached, manifest)
+}
+
+// relabelLegacyManifestWorks adds the WDS label to the ManifestWorks of this WDS created
+// by earlier releases, which are not seen by the informers selecting that label. As their
+// managed-by labels may also be those of another WDS whose name starts with the name of this
+// WDS and a dot, only the ManifestWorks whose placements all exist in this WDS are relabeled.
+func (c *Controller) relabelLegacyManifestWorks(ctx context.Context) error {
+	selector, err := labels.Parse("!" + util.WDSLabelKey)
+	if err != nil {
+		return err
+	}
+	list := &workv1.ManifestWorkList{}
+	if err := c.ocmClient.List(ctx, list, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return err
+	}
+	for i := range list.Items {
+		manifest := &list.Items[i]
+		names := util.GetLegacyPlacementNamesFromLabels(manifest.Labels, c.wdsName)
+		if len(names) == 0 {
+			continue
+		}
+		owned := true
+		for _, name := range names {
+			if _, err := c.getPlacementByName(name); err != nil {
+				owned = false
+				break
+			}
+		}
+		if !owned {
+			c.logger.Info("Not relabeling legacy ManifestWork whose placements are not found in this WDS",
+				"manifest", manifest.Name, "namespace", manifest.Namespace, "placements", names)
+			continue
+		}
+		patch := client.MergeFrom(manifest.DeepCopy())
+		manifest.Labels[util.WDSLabelKey] = c.wdsName
+		if err := c.ocmClient.Patch(ctx, manifest, patch); err != nil {
+			return err
+		}
+		c.logger.Info("Relabeled legacy ManifestWork", "manifest", manifest.Name, "namespace", manifest.Namespace)
+	}
+	return nil
+}
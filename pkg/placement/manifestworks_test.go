@@ -0,0 +1,87 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"testing"
+
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kubestellar/kubestellar/pkg/util"
+)
+
+func newTestManifestWork(name, namespace string, labels map[string]string, raw string) *workv1.ManifestWork {
+	return &workv1.ManifestWork{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+		Spec: workv1.ManifestWorkSpec{Workload: workv1.ManifestsTemplate{
+			Manifests: []workv1.Manifest{{RawExtension: runtime.RawExtension{Raw: []byte(raw)}}},
+		}},
+	}
+}
+
+func TestManifestWorkIndexes(t *testing.T) {
+	c := &Controller{wdsName: "wds1"}
+	c.manifestWorkInformer = cache.NewSharedIndexInformer(&cache.ListWatch{}, &workv1.ManifestWork{}, 0,
+		cache.Indexers{
+			manifestsByPlacementIndex: c.indexManifestWorkByPlacement,
+			manifestsBySourceIndex:    indexManifestWorkBySource,
+		})
+	indexer := c.manifestWorkInformer.GetIndexer()
+
+	deployment := `{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"d","namespace":"ns1"}}`
+	p1 := util.GenerateManagedByPlacementLabelKey("wds1", "p1")
+	p2 := util.GenerateManagedByPlacementLabelKey("wds1", "p2")
+	for _, mw := range []*workv1.ManifestWork{
+		newTestManifestWork("d", "cluster2", map[string]string{util.WDSLabelKey: "wds1", p1: "true", p2: "true"}, deployment),
+		newTestManifestWork("d", "cluster1", map[string]string{util.WDSLabelKey: "wds1", p1: "true"}, deployment),
+		newTestManifestWork("cm", "cluster1", map[string]string{util.WDSLabelKey: "wds1", p2: "true"},
+			`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm","namespace":"ns1"}}`),
+	} {
+		if err := indexer.Add(mw); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	list, err := c.listManifestsForPlacement("p1")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if namespaces := getManifestNamespaces(list); len(namespaces) != 2 || namespaces[0] != "cluster1" || namespaces[1] != "cluster2" {
+		t.Errorf("expected manifests of p1 in [cluster1 cluster2], got %v", namespaces)
+	}
+
+	obj := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: "d", Namespace: "ns1"}}
+	obj.SetGroupVersionKind(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"})
+	list, err = c.listManifestsForObject(obj)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(list) != 2 {
+		t.Errorf("expected 2 manifests for the deployment, got %d", len(list))
+	}
+
+	// the returned manifests are copies that can be modified
+	delete(list[0].Labels, p1)
+	if list, _ := c.listManifestsForPlacement("p1"); len(list) != 2 {
+		t.Errorf("expected the cache not to be modified, got %d manifests for p1", len(list))
+	}
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	applyResultApplied = "applied"
+	applyResultSkipped = "skipped"
+	applyResultError   = "error"
+
+	gcActionDeleted   = "deleted"
+	gcActionRelabeled = "relabeled"
+	gcActionReported  = "reported"
+)
+
+var (
+	// apiDiscoveryFailedGroups reports the group versions of the WDS whose discovery failed
+	apiDiscoveryFailedGroups = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kubestellar_placement_api_discovery_failed_groups",
+			Help: "Group versions of the WDS whose discovery failed in the last API discovery, set to 1.",
+		},
+		[]string{"group_version"},
+	)
+
+	// manifestApplies counts the applies of ManifestWorks to the mailboxes by result
+	manifestApplies = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kubestellar_placement_manifest_applies_total",
+			Help: "Number of ManifestWork applies to the mailboxes, by result (applied, skipped as unchanged, error).",
+		},
+		[]string{"result"},
+	)
+
+	// deliveryQueueDepth reports the number of pending ManifestWork writes per mailbox
+	deliveryQueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kubestellar_placement_delivery_queue_depth",
+			Help: "Number of ManifestWork writes waiting for the write budgets, by cluster.",
+		},
+		[]string{"cluster"},
+	)
+
+	// gcManifests counts the orphaned ManifestWorks found by the garbage collection
+	gcManifests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kubestellar_placement_gc_manifestworks_total",
+			Help: "Number of orphaned ManifestWorks found by the garbage collection, by action taken.",
+		},
+		[]string{"action"},
+	)
+
+	// queueDepth reports the number of items in the workqueue by priority class
+	queueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kubestellar_placement_queue_depth",
+			Help: "Number of items waiting in the placement controller workqueue, by priority class.",
+		},
+		[]string{"class"},
+	)
+
+	// queueLatency observes how long items wait in the workqueue by priority class
+	queueLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kubestellar_placement_queue_latency_seconds",
+			Help:    "Time items wait in the placement controller workqueue before being processed, by priority class.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+		},
+		[]string{"class"},
+	)
+)
+
+func init() {
+	// register with the controller-runtime registry, served by the manager metrics endpoint
+	metrics.Registry.MustRegister(apiDiscoveryFailedGroups, manifestApplies, deliveryQueueDepth,
+		queueDepth, queueLatency, gcManifests)
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kubestellar/kubestellar/pkg/util"
+)
+
+// the namespaces informer only caches metadata, as only the labels are used to
+// evaluate the NamespaceSelectors of the placements
+func (c *Controller) newNamespaceInformer() cache.SharedIndexInformer {
+	gvr := corev1.SchemeGroupVersion.WithResource("namespaces")
+	informer := metadatainformer.NewFilteredMetadataInformer(c.metadataClient, gvr, metav1.NamespaceAll,
+		0*time.Minute, cache.Indexers{}, nil).Informer()
+	informer.SetTransform(c.dropFields)
+	informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		// objects of a namespace created after the initial list may have been matched
+		// before the namespace was cached, i.e. without namespace labels
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			if isInInitialList {
+				return
+			}
+			ns := obj.(metav1.Object)
+			c.handleNamespaceLabelsChange(ns.GetName(), nil, ns.GetLabels())
+		},
+		UpdateFunc: func(old, new interface{}) {
+			oldNS := old.(metav1.Object)
+			newNS := new.(metav1.Object)
+			if labels.Equals(oldNS.GetLabels(), newNS.GetLabels()) {
+				return
+			}
+			c.handleNamespaceLabelsChange(newNS.GetName(), oldNS.GetLabels(), newNS.GetLabels())
+		},
+	})
+	return informer
+}
+
+// getNamespaceLabels returns the labels of the namespace from the cache
+func (c *Controller) getNamespaceLabels(name string) (map[string]string, bool) {
+	obj, exists, err := c.namespaceInformer.GetIndexer().GetByKey(name)
+	if err != nil || !exists {
+		return nil, false
+	}
+	return obj.(metav1.Object).GetLabels(), true
+}
+
+// handleNamespaceLabelsChange enqueues the placements whose NamespaceSelectors no longer
+// or newly select the namespace, so that the objects of the namespace no longer selected
+// are withdrawn by the placement cleanup, and the objects in the namespace whose kinds
+// can be selected by placements with NamespaceSelectors, so that they are matched again
+func (c *Controller) handleNamespaceLabelsChange(namespace string, oldLabels, newLabels map[string]string) {
+	for _, p := range c.placements.affectedByNamespaceChange(oldLabels, newLabels) {
+		c.logger.Info("Namespace selection changed, reconciling placement", "namespace", namespace, "placement", p.name)
+		c.workqueue.AddAfter(util.Key{
+			GvkKey:         util.GetPlacementListerKey(),
+			NamespacedName: cache.ObjectName{Name: p.name},
+		}, classPlacement, placementCoalescePeriod)
+	}
+
+	selection, err := c.getNamespaceSelectingResources()
+	if err != nil {
+		c.logger.Error(err, "Failed to list placements for namespace labels change", "namespace", namespace)
+		return
+	}
+	if len(selection) == 0 {
+		return
+	}
+
+	for _, key := range c.registry.Keys() {
+		if key == util.GetPlacementListerKey() {
+			continue
+		}
+		gvr, ok := c.registry.GetGVR(key)
+		if !ok || !selection.matches(gvr.Group, gvr.Resource) {
+			continue
+		}
+		lister, ok := c.registry.GetLister(key)
+		if !ok {
+			continue
+		}
+		objs, err := lister.ByNamespace(namespace).List(labels.Everything())
+		if err != nil {
+			c.logger.Error(err, "Failed to list objects for namespace labels change", "namespace", namespace, "key", key)
+			continue
+		}
+		for _, obj := range objs {
+			c.enqueueObject(obj, classRequeue, true)
+		}
+	}
+}
+
+// returns the resources that can be selected by the Downsync tests with NamespaceSelectors
+func (c *Controller) getNamespaceSelectingResources() (resourceSelection, error) {
+	selection := resourceSelection{}
+	placements, err := c.listPlacements()
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range placements {
+		placement, err := runtimeObjectToPlacement(obj)
+		if err != nil {
+			return nil, err
+		}
+		for _, test := range placement.Spec.Downsync {
+			if len(test.NamespaceSelectors) > 0 {
+				selection.add(test)
+			}
+		}
+	}
+	return selection, nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/kubestellar/kubestellar/api/edge/v1alpha1"
+	"github.com/kubestellar/kubestellar/pkg/informers"
+	"github.com/kubestellar/kubestellar/pkg/util"
+)
+
+func TestNamespaceStopsMatching(t *testing.T) {
+	c := &Controller{
+		logger:     logr.Discard(),
+		registry:   informers.NewRegistry(nil),
+		placements: newPlacementIndex(logr.Discard()),
+		workqueue:  newPriorityQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+	c.placements.update(newTestPlacement("prod", 1, v1alpha1.ObjectTest{
+		NamespaceSelectors: []metav1.LabelSelector{{MatchLabels: map[string]string{"env": "prod"}}},
+	}))
+
+	// the objects of the namespace no longer selected are withdrawn by the placement cleanup
+	c.handleNamespaceLabelsChange("ns1", map[string]string{"env": "prod"}, map[string]string{"env": "dev"})
+	item, _ := c.workqueue.Get()
+	expected := util.Key{GvkKey: util.GetPlacementListerKey(), NamespacedName: cache.ObjectName{Name: "prod"}}
+	if item != expected {
+		t.Errorf("expected the placement to be enqueued, got %v", item)
+	}
+	c.workqueue.Done(item)
+}
+
+func TestNamespaceCreatedAfterObject(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	scheme := metadatafake.NewTestScheme()
+	if err := metav1.AddMetaToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	metadataClient := metadatafake.NewSimpleMetadataClient(scheme)
+	c := &Controller{
+		logger:         logr.Discard(),
+		registry:       informers.NewRegistry(nil),
+		placements:     newPlacementIndex(logr.Discard()),
+		workqueue:      newPriorityQueue(workqueue.DefaultControllerRateLimiter()),
+		metadataClient: metadataClient,
+	}
+	defer c.registry.Stop()
+
+	core := ""
+	placement := newTestPlacement("prod", 1, v1alpha1.ObjectTest{
+		APIGroup:           &core,
+		Resources:          []string{"configmaps"},
+		NamespaceSelectors: []metav1.LabelSelector{{MatchLabels: map[string]string{"env": "prod"}}},
+	})
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(placement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.placements.update(placement)
+	addTestInformer(t, c.registry, util.GetPlacementListerKey(), v1alpha1.GroupVersion.WithResource(util.PlacementResource),
+		unstructured.Unstructured{Object: content})
+	cm := unstructured.Unstructured{}
+	cm.SetAPIVersion("v1")
+	cm.SetKind("ConfigMap")
+	cm.SetNamespace("ns1")
+	cm.SetName("cm")
+	addTestInformer(t, c.registry, "v1/ConfigMap", schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, cm)
+
+	c.namespaceInformer = c.newNamespaceInformer()
+	go c.namespaceInformer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), c.namespaceInformer.HasSynced) {
+		t.Fatal("namespace informer not synced")
+	}
+
+	// the object is matched before its namespace is cached
+	if c.testObject(&cm, placement.Spec.Downsync) {
+		t.Fatalf("expected the object not to match before its namespace is cached")
+	}
+	err = metadataClient.Tracker().Create(corev1.SchemeGroupVersion.WithResource("namespaces"), &metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+		ObjectMeta: metav1.ObjectMeta{Name: "ns1", Labels: map[string]string{"env": "prod"}},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the object is matched again once the namespace is added
+	item, _ := c.workqueue.Get()
+	if key, ok := item.(util.Key); !ok || key.NamespacedName.Name != "cm" {
+		t.Errorf("expected the object of the namespace to be requeued, got %v", item)
+	}
+	c.workqueue.Done(item)
+	if !c.testObject(&cm, placement.Spec.Downsync) {
+		t.Errorf("expected the object to match once its namespace is cached")
+	}
+}
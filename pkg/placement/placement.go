@@ -18,50 +18,63 @@ package placement
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
 
-	"github.com/go-logr/logr"
 	workv1 "open-cluster-management.io/api/work/v1"
 
-	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	"github.com/kubestellar/kubestellar/api/edge/v1alpha1"
-	"github.com/kubestellar/kubestellar/pkg/ocm"
 	"github.com/kubestellar/kubestellar/pkg/util"
 )
 
 const (
 	waitBeforeTrackingPlacements = 5 * time.Second
+	placementCoalescePeriod      = 1 * time.Second
 	PlacementKind                = "Placement"
 	KSFinalizer                  = "placement.kubestellar.io/kscontroller"
 )
 
 // Handle placement as follows:
-//  1. requeue all objects to account for changes in placement
+//  1. requeue the objects selected by the previous or current placement spec
 //  2. handle finalizers and deletion of objects associated with the placement
-//  3. for updates on label selectors, re-evaluate if existing objects should be removed
+//  3. start and stop informers for the resources selected by placements
+//  4. for updates on label selectors, re-evaluate if existing objects should be removed
 //     from clusters.
 func (c *Controller) handlePlacement(obj runtime.Object) error {
 	placement := obj.DeepCopyObject()
+	mObj := obj.(metav1.Object)
 
 	// handle requeing for changes in placement, excluding deletion
 	if !isBeingDeleted(obj) {
-		if err := c.requeueForPlacementChanges(); err != nil {
+		if err := c.requeueForPlacementChanges(mObj.GetName()); err != nil {
 			return err
 		}
 	}
 
+	// start or stop informers for the resources selected by the placements
+	if err := c.updateWatchedResourcesForPlacements(); err != nil {
+		return err
+	}
+
+	// the ManifestWorks of the placement are managed by the shard owning it
+	if !c.ownsPlacement(mObj.GetName()) {
+		return nil
+	}
+
 	if err := c.handlePlacementFinalizer(placement); err != nil {
 		return err
 	}
@@ -73,24 +86,28 @@ func (c *Controller) handlePlacement(obj runtime.Object) error {
 	return nil
 }
 
-func (c *Controller) requeueForPlacementChanges() error {
+// requeueForPlacementChanges enqueues the objects that match either the previous or the
+// current version of the placement tests. Changes to a placement made before its previous
+// changes were processed are coalesced into a single requeue.
+func (c *Controller) requeueForPlacementChanges(name string) error {
+	tests := c.placements.takePendingRequeue(name)
 	// allow some time before checking to settle
 	now := time.Now()
-	if now.Sub(c.initializedTs) < waitBeforeTrackingPlacements {
+	if now.Sub(c.initializedTs) < waitBeforeTrackingPlacements || len(tests) == 0 {
 		return nil
 	}
-	if err := c.requeueAll(); err != nil {
+	if err := c.requeueMatching(tests); err != nil {
+		c.placements.addPendingRequeue(name, tests)
 		return err
 	}
 	return nil
 }
 
 func (c *Controller) getPlacementByName(name string) (runtime.Object, error) {
-	pLister := c.listers["edge.kubestellar.io/v1alpha1/Placement"]
-	if pLister == nil {
+	lister, ok := c.registry.GetLister(util.GetPlacementListerKey())
+	if !ok {
 		return nil, fmt.Errorf("could not get lister for placememt")
 	}
-	lister := *pLister
 	got, err := lister.Get(name)
 	if err != nil {
 		return nil, err
@@ -99,11 +116,10 @@ func (c *Controller) getPlacementByName(name string) (runtime.Object, error) {
 }
 
 func (c *Controller) listPlacements() ([]runtime.Object, error) {
-	pLister := c.listers["edge.kubestellar.io/v1alpha1/Placement"]
-	if pLister == nil {
+	lister, ok := c.registry.GetLister(util.GetPlacementListerKey())
+	if !ok {
 		return nil, fmt.Errorf("could not get lister for placememt")
 	}
-	lister := *pLister
 	list, err := lister.List(labels.Everything())
 	if err != nil {
 		return nil, err
@@ -123,28 +139,64 @@ func runtimeObjectToPlacement(obj runtime.Object) (*v1alpha1.Placement, error) {
 	return placement, nil
 }
 
-// read objects from all listers and enqueue the keys
-// this is useful for when a new placement is added
-// or a placement is updated
-func (c *Controller) requeueAll() error {
-	for key, ptr := range c.listers {
+// read the objects that can be selected by the tests from the listers, and enqueue
+// the keys of the objects matching any of the tests
+func (c *Controller) requeueMatching(tests compiledTests) error {
+	for _, key := range c.registry.Keys() {
 		// do not requeue placement
 		if key == util.GetPlacementListerKey() {
-			fmt.Printf("Matched key %s\n", key)
 			continue
 		}
-		lister := *ptr
-		objs, err := lister.List(labels.Everything())
+		gvr, ok := c.registry.GetGVR(key)
+		if !ok {
+			continue
+		}
+		candidates := compiledTests{}
+		for _, test := range tests {
+			if test.selectsResource(gvr.Group, gvr.Resource) {
+				candidates = append(candidates, test)
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		lister, ok := c.registry.GetLister(key)
+		if !ok {
+			continue
+		}
+		objs, err := listForTests(lister, candidates)
 		if err != nil {
 			return err
 		}
 		for _, obj := range objs {
-			c.enqueueObject(obj, true)
+			if candidates.matches(c.newObjectInfo(obj.(mrObject), gvr)) {
+				c.enqueueObject(obj, classRequeue, true)
+			}
 		}
 	}
 	return nil
 }
 
+// lists only the namespaces named by the tests, unless some test matches any namespace
+func listForTests(lister cache.GenericLister, tests compiledTests) ([]runtime.Object, error) {
+	namespaces := sets.New[string]()
+	for _, test := range tests {
+		if test.namespaces.Len() == 0 || test.namespaces.Has(anyValue) {
+			return lister.List(labels.Everything())
+		}
+		namespaces = namespaces.Union(test.namespaces)
+	}
+	objs := []runtime.Object{}
+	for _, ns := range sets.List(namespaces) {
+		nsObjs, err := lister.ByNamespace(ns).List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, nsObjs...)
+	}
+	return objs, nil
+}
+
 // finalizer logic
 func (c *Controller) handlePlacementFinalizer(obj runtime.Object) error {
 	mObj := obj.(metav1.Object)
@@ -157,6 +209,7 @@ func (c *Controller) handlePlacementFinalizer(obj runtime.Object) error {
 			if err := c.deleteExternalResources(obj); err != nil {
 				return err
 			}
+			c.delivery.forgetPlacement(mObj.GetName())
 			controllerutil.RemoveFinalizer(cObj, KSFinalizer)
 			if err = updatePlacement(*c.dynamicClient, obj); err != nil {
 				return err
@@ -182,51 +235,57 @@ func convertToClientObject(obj runtime.Object) (client.Object, error) {
 	return clientObj, nil
 }
 
+// updates the finalizers of the placement with a merge patch. The placement in the cache
+// has fields dropped by the informer transform, so it cannot be used for an update
+// without removing those fields, e.g. the last-applied-configuration annotation.
 func updatePlacement(client dynamic.DynamicClient, obj runtime.Object) error {
 	gvr := schema.GroupVersionResource{
 		Group:    v1alpha1.GroupVersion.Group,
 		Version:  obj.GetObjectKind().GroupVersionKind().Version,
 		Resource: "placements",
 	}
-	unstructuredObj, ok := obj.(*unstructured.Unstructured)
-	if !ok {
-		return fmt.Errorf("unexpected type for obj, expected *unstructured.Unstructured")
+	mObj := obj.(metav1.Object)
+	// the resourceVersion makes the patch fail on conflicts, as for an update
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"finalizers":      mObj.GetFinalizers(),
+			"resourceVersion": mObj.GetResourceVersion(),
+		},
+	})
+	if err != nil {
+		return err
 	}
-	client.Resource(gvr).Namespace("").Update(context.Background(), unstructuredObj, metav1.UpdateOptions{})
-	return nil
+	_, err = client.Resource(gvr).Patch(context.Background(), mObj.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
 }
 
 func (c *Controller) deleteExternalResources(obj runtime.Object) error {
-	list, err := listManifestsForPlacement(c.ocmClient, c.wdsName, obj)
+	mObj := obj.(metav1.Object)
+	written := c.cancelPlacementDeliveries(mObj.GetName())
+	list, err := c.listManifestsForPlacement(mObj.GetName())
+	if err != nil {
+		return err
+	}
+	list = mergeManifests(list, written)
+	placement, err := runtimeObjectToPlacement(obj)
 	if err != nil {
 		return err
 	}
-	mObj := obj.(metav1.Object)
 	labelKey := util.GenerateManagedByPlacementLabelKey(c.wdsName, mObj.GetName())
-	for _, manifest := range list.Items {
+	for _, manifest := range list {
 		c.logger.Info("Trying to delete manifest", "manifest name", manifest.Name, "namespace", manifest.Namespace, "for placement", mObj.GetName())
-		if err := deleteManifestOrLabel(labelKey, manifest, c.ocmClient); err != nil {
+		orphan := orphanOnWithdrawal(manifest, placement.Spec.DeletionPolicy)
+		if err := deleteManifestOrLabel(labelKey, manifest, c.ocmClient, orphan); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func listManifestsForPlacement(ocmClient client.Client, wdsName string, obj runtime.Object) (*workv1.ManifestWorkList, error) {
-	mObj := obj.(metav1.Object)
-	list := &workv1.ManifestWorkList{}
-	labelKey := util.GenerateManagedByPlacementLabelKey(wdsName, mObj.GetName())
-
-	// TODO - the ocm client used this way is not using cache. Replace with informer/lister based
-	// on dynamic client to make sure to use the cache
-	if err := ocmClient.List(context.TODO(), list, client.InNamespace(""),
-		client.MatchingLabels(map[string]string{labelKey: util.PlacementLabelValueEnabled})); err != nil {
-		return nil, err
-	}
-	return list, nil
-}
-
-func deleteManifestOrLabel(managedByLabelKey string, manifest workv1.ManifestWork, ocmClient client.Client) error {
+// deleteManifestOrLabel withdraws the ManifestWork on behalf of a placement: the label of
+// the placement is removed if other placements manage the ManifestWork, otherwise it is
+// deleted, orphaning the wrapped object if orphan is true
+func deleteManifestOrLabel(managedByLabelKey string, manifest workv1.ManifestWork, ocmClient client.Client, orphan bool) error {
 	labels := manifest.GetLabels()
 
 	if isAlsoManagedByOtherPlacements(labels, managedByLabelKey) {
@@ -238,14 +297,7 @@ func deleteManifestOrLabel(managedByLabelKey string, manifest workv1.ManifestWor
 	}
 
 	// if no other labels can safely delete
-	if err := ocmClient.Delete(context.TODO(), &manifest, &client.DeleteOptions{}); err != nil {
-		// can ignore as it could be already deleted by another thread
-		if errors.IsNotFound(err) {
-			return nil
-		}
-		return err
-	}
-	return nil
+	return deleteManifest(ocmClient, &manifest, orphan)
 }
 
 func isAlsoManagedByOtherPlacements(labels map[string]string, managedByLabelKey string) bool {
@@ -275,12 +327,21 @@ func (c *Controller) cleanUpObjectsNoLongerMatching(placement runtime.Object) er
 		return nil
 	}
 
-	list, err := listManifestsForPlacement(c.ocmClient, c.wdsName, placement)
+	name := placement.(metav1.Object).GetName()
+	written := c.cancelPlacementDeliveries(name)
+	list, err := c.listManifestsForPlacement(name)
 	if err != nil {
 		return err
 	}
+	list = mergeManifests(list, written)
+	p, err := runtimeObjectToPlacement(placement)
+	if err != nil {
+		return err
+	}
+	policy := p.Spec.DeletionPolicy
+	labelKey := util.GenerateManagedByPlacementLabelKey(c.wdsName, name)
 
-	for _, manifest := range list.Items {
+	for _, manifest := range list {
 		obj, err := extractObjectFromManifest(manifest)
 		if err != nil {
 			return err
@@ -290,7 +351,8 @@ func (c *Controller) cleanUpObjectsNoLongerMatching(placement runtime.Object) er
 			return err
 		}
 		if !matches {
-			if err := c.ocmClient.Delete(context.TODO(), &manifest, &client.DeleteOptions{}); err != nil {
+			orphan := orphanOnWithdrawal(manifest, policy)
+			if err := deleteManifestOrLabel(labelKey, manifest, c.ocmClient, orphan); err != nil {
 				return err
 			}
 		}
@@ -335,11 +397,11 @@ func (c *Controller) checkObjectMatchesWhatAndWhere(placementObj, obj runtime.Ob
 
 	// check the Where matches
 	clusterName := getClusterNameFromManifest(manifest)
-	matchedClusters, err := ocm.ListClustersBySelectors(c.ocmClient, placement.Spec.ClusterSelectors)
+	matchedClusters, err := c.listClusters(compilePlacement(c.logger, placement))
 	if err != nil {
 		return match, err
 	}
-	if !util.StringInSlice(clusterName, matchedClusters) {
+	if !matchedClusters.Has(clusterName) {
 		c.logger.Info("The 'Where' no longer matches. Object marked for removal.", "object", util.GenerateObjectInfoString(obj), "for placement", placement.GetName(), "cluster", clusterName)
 		return false, nil
 	}
@@ -353,63 +415,44 @@ type mrObject interface {
 }
 
 func (c *Controller) testObject(obj mrObject, tests []v1alpha1.ObjectTest) bool {
+	info, ok := c.getObjectInfo(obj)
+	if !ok {
+		return false
+	}
+	return compileObjectTests(c.logger, tests).matches(info)
+}
+
+// getObjectInfo returns the information used to match the object against the placements
+func (c *Controller) getObjectInfo(obj mrObject) (objectInfo, bool) {
 	objNSName := obj.GetNamespace()
 	objName := obj.GetName()
-	objLabels := obj.GetLabels()
 	gvk := obj.GetObjectKind().GroupVersionKind()
 	gvkKey := util.KeyForGroupVersionKind(gvk.Group, gvk.Version, gvk.Kind)
-	objGVR, haveGVR := c.gvksMap[gvkKey]
+	objGVR, haveGVR := c.registry.GetGVR(gvkKey)
 	if !haveGVR {
 		c.logger.Info("No GVR, assuming object does not match", "gvk", gvk, "objNS", objNSName, "objName", objName)
-		return false
+		return objectInfo{}, false
 	}
-	var objNS *corev1.Namespace
-	for _, test := range tests {
-		if test.APIGroup != nil && (*test.APIGroup) != gvk.Group {
-			continue
-		}
-		if len(test.Resources) > 0 && !(SliceContains(test.Resources, "*") || SliceContains(test.Resources, objGVR.Resource)) {
-			continue
-		}
-		if len(test.Namespaces) > 0 && !(SliceContains(test.Namespaces, "*") || SliceContains(test.Namespaces, objNSName)) {
-			continue
-		}
-		if len(test.ObjectNames) > 0 && !(SliceContains(test.ObjectNames, "*") || SliceContains(test.ObjectNames, objName)) {
-			continue
-		}
-		if len(test.ObjectSelectors) > 0 && !labelsMatchAny(c.logger, objLabels, test.ObjectSelectors) {
-			continue
-		}
-		if len(test.NamespaceSelectors) > 0 {
-			if objNS == nil {
-				var err error
-				objNS, err = c.kubernetesClient.CoreV1().Namespaces().Get(nil, objNSName, metav1.GetOptions{})
-				if err != nil {
-					c.logger.Info("Object namespace not found, assuming object does not match", "gvk", gvk, "objNS", objNSName, "objName", objName)
-					continue
-				}
-			}
-			if !labelsMatchAny(c.logger, objNS.Labels, test.NamespaceSelectors) {
-				continue
-			}
-		}
-		return true
-	}
-	return false
+	return c.newObjectInfo(obj, objGVR), true
 }
 
-func labelsMatchAny(logger logr.Logger, labelSet map[string]string, selectors []metav1.LabelSelector) bool {
-	for _, ls := range selectors {
-		sel, err := metav1.LabelSelectorAsSelector(&ls)
-		if err != nil {
-			logger.Info("Failed to convert LabelSelector to labels.Selector", "ls", ls, "err", err)
-			continue
-		}
-		if sel.Matches(labels.Set(labelSet)) {
-			return true
-		}
+func (c *Controller) newObjectInfo(obj mrObject, gvr schema.GroupVersionResource) objectInfo {
+	objNSName := obj.GetNamespace()
+	objName := obj.GetName()
+	return objectInfo{
+		group:     gvr.Group,
+		resource:  gvr.Resource,
+		namespace: objNSName,
+		name:      objName,
+		labels:    obj.GetLabels(),
+		namespaceLabels: func() (map[string]string, bool) {
+			nsLabels, found := c.getNamespaceLabels(objNSName)
+			if !found {
+				c.logger.Info("Object namespace not found, assuming object does not match", "gvr", gvr, "objNS", objNSName, "objName", objName)
+			}
+			return nsLabels, found
+		},
 	}
-	return false
 }
 
 func getClusterNameFromManifest(manifest workv1.ManifestWork) string {
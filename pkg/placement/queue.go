@@ -0,0 +1,237 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// queueClass is the priority class of a workqueue item, lower values are processed first
+type queueClass int
+
+const (
+	// deletions of objects and cleanups of mailboxes
+	classDeletion queueClass = iota
+	// placement and CRD events
+	classPlacement
+	// creations and updates of objects
+	classEdit
+	// objects requeued for placement, namespace or shard changes, or cancelled deliveries
+	classRequeue
+	// objects listed at startup
+	classResync
+	numQueueClasses
+)
+
+var queueClassNames = [numQueueClasses]string{"deletion", "placement", "edit", "requeue", "resync"}
+
+func (q queueClass) String() string {
+	return queueClassNames[q]
+}
+
+// pendingItem is an item waiting in the queue
+type pendingItem struct {
+	class queueClass
+	added time.Time
+}
+
+// priorityQueue is a workqueue with priority classes: Get returns the items of the highest
+// priority class first, in FIFO order within a class. As in the client-go workqueue, an
+// item is queued at most once, and an item added while processed is queued again when
+// done. An item added again with a higher priority is promoted.
+// Items added with a delay wait until they are ready; an item already waiting keeps its
+// earliest ready time, so that delayed adds are coalesced.
+type priorityQueue struct {
+	cond *sync.Cond
+	// FIFO per class; entries whose item was promoted or already taken are skipped
+	queues     [numQueueClasses][]interface{}
+	dirty      map[interface{}]pendingItem
+	processing map[interface{}]queueClass
+	// items added while processed, queued again when done
+	requeue map[interface{}]pendingItem
+	// ready time of the items added with a delay
+	waiting      map[interface{}]time.Time
+	shuttingDown bool
+	rateLimiter  workqueue.RateLimiter
+	now          func() time.Time
+}
+
+func newPriorityQueue(rateLimiter workqueue.RateLimiter) *priorityQueue {
+	return &priorityQueue{
+		cond:        sync.NewCond(&sync.Mutex{}),
+		dirty:       map[interface{}]pendingItem{},
+		processing:  map[interface{}]queueClass{},
+		requeue:     map[interface{}]pendingItem{},
+		waiting:     map[interface{}]time.Time{},
+		rateLimiter: rateLimiter,
+		now:         time.Now,
+	}
+}
+
+// Add queues the item in the class, or promotes it if it is queued with a lower priority
+func (q *priorityQueue) Add(item interface{}, class queueClass) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	q.addLocked(item, class)
+}
+
+func (q *priorityQueue) addLocked(item interface{}, class queueClass) {
+	if q.shuttingDown {
+		return
+	}
+	if _, ok := q.processing[item]; ok {
+		if pending, ok := q.requeue[item]; !ok || class < pending.class {
+			q.requeue[item] = pendingItem{class: class, added: q.now()}
+		}
+		return
+	}
+	pending, ok := q.dirty[item]
+	if ok && pending.class <= class {
+		return
+	}
+	added := q.now()
+	if ok {
+		// promoted items keep their queuing time for the latency metrics
+		added = pending.added
+	}
+	q.dirty[item] = pendingItem{class: class, added: added}
+	q.queues[class] = append(q.queues[class], item)
+	queueDepth.WithLabelValues(class.String()).Inc()
+	if ok {
+		queueDepth.WithLabelValues(pending.class.String()).Dec()
+	}
+	q.cond.Signal()
+}
+
+// AddAfter queues the item in the class once the delay has passed
+func (q *priorityQueue) AddAfter(item interface{}, class queueClass, delay time.Duration) {
+	if delay <= 0 {
+		q.Add(item, class)
+		return
+	}
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	if q.shuttingDown {
+		return
+	}
+	ready := q.now().Add(delay)
+	if current, ok := q.waiting[item]; ok && !ready.Before(current) {
+		return
+	}
+	q.waiting[item] = ready
+	time.AfterFunc(delay, func() {
+		q.cond.L.Lock()
+		defer q.cond.L.Unlock()
+		// a later timer for an item whose ready time was moved earlier does nothing
+		if current, ok := q.waiting[item]; !ok || !current.Equal(ready) {
+			return
+		}
+		delete(q.waiting, item)
+		q.addLocked(item, class)
+	})
+}
+
+// AddRateLimited queues the item again in the class it was processed in, after the
+// delay of the rate limiter
+func (q *priorityQueue) AddRateLimited(item interface{}) {
+	q.cond.L.Lock()
+	class, ok := q.processing[item]
+	q.cond.L.Unlock()
+	if !ok {
+		class = classResync
+	}
+	q.AddAfter(item, class, q.rateLimiter.When(item))
+}
+
+// Forget clears the rate limiter history of the item
+func (q *priorityQueue) Forget(item interface{}) {
+	q.rateLimiter.Forget(item)
+}
+
+// Get blocks until an item is available and returns the item with the highest priority.
+// Returns shutdown true when the queue is shut down and empty.
+func (q *priorityQueue) Get() (interface{}, bool) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	for len(q.dirty) == 0 && !q.shuttingDown {
+		q.cond.Wait()
+	}
+	if len(q.dirty) == 0 {
+		return nil, true
+	}
+	for class := queueClass(0); class < numQueueClasses; class++ {
+		for len(q.queues[class]) > 0 {
+			item := q.queues[class][0]
+			q.queues[class][0] = nil
+			q.queues[class] = q.queues[class][1:]
+			pending, ok := q.dirty[item]
+			if !ok || pending.class != class {
+				// stale entry of a promoted item
+				continue
+			}
+			delete(q.dirty, item)
+			q.processing[item] = class
+			queueDepth.WithLabelValues(class.String()).Dec()
+			queueLatency.WithLabelValues(class.String()).Observe(q.now().Sub(pending.added).Seconds())
+			return item, false
+		}
+	}
+	// not reached, as every dirty item has an entry in its class
+	return nil, true
+}
+
+// Done marks the item as processed, queuing it again if it was added while processed
+func (q *priorityQueue) Done(item interface{}) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	delete(q.processing, item)
+	if pending, ok := q.requeue[item]; ok {
+		delete(q.requeue, item)
+		q.addLocked(item, pending.class)
+	}
+	q.cond.Broadcast()
+}
+
+// Len returns the number of queued items
+func (q *priorityQueue) Len() int {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return len(q.dirty)
+}
+
+// ShutDown stops the queue from accepting items; Get returns the queued items and then
+// reports the shutdown
+func (q *priorityQueue) ShutDown() {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	q.shuttingDown = true
+	q.cond.Broadcast()
+}
+
+// ShutDownWithDrain is like ShutDown, and waits for the items being processed to be done
+func (q *priorityQueue) ShutDownWithDrain() {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	q.shuttingDown = true
+	q.cond.Broadcast()
+	for len(q.processing) > 0 {
+		q.cond.Wait()
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/kubestellar/kubestellar/api/edge/v1alpha1"
+	"github.com/kubestellar/kubestellar/pkg/informers"
+	"github.com/kubestellar/kubestellar/pkg/util"
+)
+
+func getAll(t *testing.T, q *priorityQueue) []interface{} {
+	items := []interface{}{}
+	for q.Len() > 0 {
+		item, shutdown := q.Get()
+		if shutdown {
+			t.Fatalf("unexpected shutdown")
+		}
+		items = append(items, item)
+		q.Done(item)
+	}
+	return items
+}
+
+func expectItems(t *testing.T, got []interface{}, expected ...interface{}) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+	}
+}
+
+func TestPriorityQueueOrder(t *testing.T) {
+	q := newPriorityQueue(workqueue.DefaultControllerRateLimiter())
+	q.Add("resync-1", classResync)
+	q.Add("requeue-1", classRequeue)
+	q.Add("edit-1", classEdit)
+	q.Add("resync-2", classResync)
+	q.Add("placement-1", classPlacement)
+	q.Add("deletion-1", classDeletion)
+	// queued items are not duplicated, and are promoted to a higher priority
+	q.Add("edit-1", classResync)
+	q.Add("resync-2", classDeletion)
+
+	expectItems(t, getAll(t, q), "deletion-1", "resync-2", "placement-1", "edit-1", "requeue-1", "resync-1")
+}
+
+func TestPriorityQueueProcessing(t *testing.T) {
+	q := newPriorityQueue(workqueue.DefaultControllerRateLimiter())
+	q.Add("a", classEdit)
+	item, _ := q.Get()
+	// added while processed, queued again once done
+	q.Add("a", classResync)
+	q.Add("a", classPlacement)
+	q.Add("b", classResync)
+	if q.Len() != 1 {
+		t.Fatalf("expected 1 queued item, got %d", q.Len())
+	}
+	q.Done(item)
+
+	expectItems(t, getAll(t, q), "a", "b")
+}
+
+func TestPriorityQueueAddAfter(t *testing.T) {
+	q := newPriorityQueue(workqueue.DefaultControllerRateLimiter())
+	q.AddAfter("a", classPlacement, time.Hour)
+	// coalesced with the earliest ready time
+	q.AddAfter("a", classPlacement, 10*time.Millisecond)
+	q.AddAfter("a", classPlacement, time.Hour)
+	if q.Len() != 0 {
+		t.Fatalf("expected no queued item before the delay")
+	}
+	item, _ := q.Get()
+	if item != "a" {
+		t.Fatalf("expected a, got %v", item)
+	}
+	q.Done(item)
+	time.Sleep(50 * time.Millisecond)
+	if q.Len() != 0 {
+		t.Fatalf("expected delayed adds to be coalesced, got %d queued items", q.Len())
+	}
+}
+
+func TestPriorityQueueShutDownWithDrain(t *testing.T) {
+	q := newPriorityQueue(workqueue.DefaultControllerRateLimiter())
+	q.Add("a", classEdit)
+	q.Add("b", classEdit)
+	item, _ := q.Get()
+	q.ShutDown()
+
+	drained := make(chan struct{})
+	go func() {
+		q.ShutDownWithDrain()
+		close(drained)
+	}()
+	// queued items are still returned after the shutdown
+	next, shutdown := q.Get()
+	if shutdown || next != "b" {
+		t.Fatalf("expected b, got %v (shutdown %v)", next, shutdown)
+	}
+	q.Done(next)
+	q.Add("c", classDeletion)
+	select {
+	case <-drained:
+		t.Fatalf("expected the drain to wait for the item being processed")
+	case <-time.After(20 * time.Millisecond):
+	}
+	q.Done(item)
+	<-drained
+	if _, shutdown := q.Get(); !shutdown {
+		t.Fatalf("expected shutdown")
+	}
+}
+
+func TestPlacementRequeuePriority(t *testing.T) {
+	c := &Controller{
+		logger:    logr.Discard(),
+		registry:  informers.NewRegistry(nil),
+		workqueue: newPriorityQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+	defer c.registry.Stop()
+	newConfigMap := func(name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("ConfigMap")
+		obj.SetNamespace("ns1")
+		obj.SetName(name)
+		return obj
+	}
+	addTestInformer(t, c.registry, "v1/ConfigMap", schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+		*newConfigMap("selected"))
+
+	// objects listed at startup are still pending when the placement changes
+	c.enqueueObject(newConfigMap("listed-1"), classResync, true)
+	c.enqueueObject(newConfigMap("listed-2"), classResync, true)
+	core := ""
+	placement := newTestPlacement("p", 1, v1alpha1.ObjectTest{APIGroup: &core, Resources: []string{"configmaps"}})
+	if err := c.requeueMatching(compilePlacement(c.logger, placement).downsync); err != nil {
+		t.Fatal(err)
+	}
+
+	item, _ := c.workqueue.Get()
+	if key, ok := item.(util.Key); !ok || key.NamespacedName.Name != "selected" {
+		t.Errorf("expected the object requeued for the placement before the pending resyncs, got %v", item)
+	}
+	c.workqueue.Done(item)
+}
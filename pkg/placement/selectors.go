@@ -19,7 +19,6 @@ package placement
 import (
 	"k8s.io/apimachinery/pkg/runtime"
 
-	"github.com/kubestellar/kubestellar/pkg/ocm"
 	"github.com/kubestellar/kubestellar/pkg/util"
 )
 
@@ -28,37 +27,29 @@ import (
 // (the latter forces the selection  of only one cluster)
 func (c *Controller) matchSelectors(obj runtime.Object) ([]string, []string, bool, error) {
 	managedByPlacementList := []string{}
-	objMR := obj.(mrObject)
-	placements, err := c.listPlacements()
-	if err != nil {
-		return nil, nil, false, err
+	info, ok := c.getObjectInfo(obj.(mrObject))
+	if !ok {
+		return nil, nil, false, nil
 	}
 	clustersMap := map[string]string{}
 	// if a placement wants single reported status we force to select only one cluster
 	wantSingletonStatus := false
-	for _, item := range placements {
-		placement, err := runtimeObjectToPlacement(item)
-		if err != nil {
-			return nil, nil, false, err
-		}
-		matchedSome := c.testObject(objMR, placement.Spec.Downsync)
-		if !matchedSome {
+	// only the placements with tests for the group, resource and namespace of the object are evaluated
+	for _, placement := range c.placements.lookup(info.group, info.resource, info.namespace) {
+		if !placement.downsync.matches(info) {
 			continue
 		}
 		// WantSingletonReportedState for multiple placement are OR'd
-		if placement.Spec.WantSingletonReportedState {
+		if placement.wantSingletonStatus {
 			wantSingletonStatus = true
 		}
-		managedByPlacementList = append(managedByPlacementList, placement.GetName())
-		c.logger.Info("Matched", "object", util.GenerateObjectInfoString(obj), "for placement", placement.GetName())
-		list, err := ocm.ListClustersBySelectors(c.ocmClient, placement.Spec.ClusterSelectors)
+		managedByPlacementList = append(managedByPlacementList, placement.name)
+		c.logger.Info("Matched", "object", util.GenerateObjectInfoString(obj), "for placement", placement.name)
+		clusters, err := c.getClustersForPlacement(placement)
 		if err != nil {
 			return nil, nil, false, err
 		}
-		if list == nil {
-			continue
-		}
-		for _, s := range list {
+		for s := range clusters {
 			clustersMap[s] = ""
 		}
 	}
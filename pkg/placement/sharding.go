@@ -0,0 +1,74 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/kubestellar/kubestellar/pkg/shard"
+)
+
+// Sharder selects the keys reconciled by this replica when the controller is sharded,
+// e.g. a shard.Claimer. Every replica watches all the objects, placements and clusters,
+// but only delivers the objects in its shards. The placement-wide operations (finalizer,
+// cleanup of the ManifestWorks of a placement) and the cleanup of the mailboxes of
+// removed clusters are done by the replica owning the placement or cluster.
+type Sharder interface {
+	Owns(key string) bool
+	AddChangeHandler(handler func())
+}
+
+func (c *Controller) ownsKey(key string) bool {
+	return c.sharder == nil || c.sharder.Owns(key)
+}
+
+// ownsObject returns true if the object is in a shard of this replica
+func (c *Controller) ownsObject(obj runtime.Object) bool {
+	if c.sharder == nil {
+		return true
+	}
+	return c.sharder.Owns(shard.ObjectKey(obj.GetObjectKind().GroupVersionKind(), obj.(metav1.Object).GetNamespace()))
+}
+
+func (c *Controller) ownsPlacement(name string) bool {
+	return c.ownsKey("placement/" + name)
+}
+
+func (c *Controller) ownsCluster(name string) bool {
+	return c.ownsKey("cluster/" + name)
+}
+
+// requeueAll enqueues all the objects, when the shards of this replica change. The
+// objects not in the shards of this replica are dropped by enqueueObject.
+func (c *Controller) requeueAll() {
+	for _, key := range c.registry.Keys() {
+		lister, ok := c.registry.GetLister(key)
+		if !ok {
+			continue
+		}
+		objs, err := lister.List(labels.Everything())
+		if err != nil {
+			c.logger.Error(err, "Failed to list objects for shards change", "key", key)
+			continue
+		}
+		for _, obj := range objs {
+			c.enqueueObject(obj, classRequeue, true)
+		}
+	}
+}
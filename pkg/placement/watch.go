@@ -0,0 +1,160 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/kubestellar/kubestellar/api/edge/v1alpha1"
+	"github.com/kubestellar/kubestellar/pkg/util"
+)
+
+const anyValue = "*"
+
+// resourceSelection is the set of API resources that can be selected by the Downsync
+// tests of the placements, as a map from API group to resource names. The key "*" stands
+// for any group and the resource "*" for any resource in the group.
+type resourceSelection map[string]sets.Set[string]
+
+// add the resources that can be selected by the test
+func (s resourceSelection) add(test v1alpha1.ObjectTest) {
+	group := anyValue
+	if test.APIGroup != nil {
+		group = *test.APIGroup
+	}
+	resources, ok := s[group]
+	if !ok {
+		resources = sets.New[string]()
+		s[group] = resources
+	}
+	if len(test.Resources) == 0 {
+		resources.Insert(anyValue)
+		return
+	}
+	resources.Insert(test.Resources...)
+}
+
+// matches returns true if the resource in the group can be selected
+func (s resourceSelection) matches(group, resource string) bool {
+	for _, g := range []string{group, anyValue} {
+		if resources, ok := s[g]; ok && (resources.Has(anyValue) || resources.Has(resource)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAll returns true if a wildcard test selects every resource
+func (s resourceSelection) matchesAll() bool {
+	resources, ok := s[anyValue]
+	return ok && resources.Has(anyValue)
+}
+
+// getResourceSelection computes the union of the resources selected by the Downsync tests
+// of all the placements. Placements being deleted are ignored. Before the placement
+// informer is started the selection is empty.
+func (c *Controller) getResourceSelection() (resourceSelection, error) {
+	selection := resourceSelection{}
+	lister, ok := c.registry.GetLister(util.GetPlacementListerKey())
+	if !ok {
+		return selection, nil
+	}
+	list, err := lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range list {
+		placement, err := runtimeObjectToPlacement(obj)
+		if err != nil {
+			return nil, err
+		}
+		if placement.GetDeletionTimestamp() != nil {
+			continue
+		}
+		for _, test := range placement.Spec.Downsync {
+			selection.add(test)
+		}
+	}
+	return selection, nil
+}
+
+// updateWatchedResources starts and stops informers so that the watched resources are
+// those available in the WDS that can be selected by the placements
+func (c *Controller) updateWatchedResources() error {
+	selection, err := c.getResourceSelection()
+	if err != nil {
+		return err
+	}
+
+	c.watchLock.Lock()
+	defer c.watchLock.Unlock()
+	return c.updateWatchedResourcesLocked(selection)
+}
+
+// updateWatchedResourcesForPlacements is like updateWatchedResources, but does nothing
+// unless the resources selected by the placements changed, so that the API discovery is
+// not repeated for every placement event
+func (c *Controller) updateWatchedResourcesForPlacements() error {
+	selection, err := c.getResourceSelection()
+	if err != nil {
+		return err
+	}
+
+	c.watchLock.Lock()
+	defer c.watchLock.Unlock()
+	if reflect.DeepEqual(selection, c.watchedSelection) {
+		return nil
+	}
+	return c.updateWatchedResourcesLocked(selection)
+}
+
+func (c *Controller) updateWatchedResourcesLocked(selection resourceSelection) error {
+	if selection.matchesAll() && !c.watchedSelection.matchesAll() {
+		c.logger.Info("A placement has a wildcard downsync test, watching all resources")
+	}
+
+	toStartList, toStopList, err := c.checkAPIResourcesForUpdates(selection)
+	if err != nil {
+		return err
+	}
+
+	c.startInformersForNewAPIResources(toStartList)
+
+	errs := []error{}
+	for _, key := range toStopList {
+		// the informers of kinds whose objects still carry the finalizer are kept until it
+		// is removed, and the selection is computed again on the next placement event
+		if err := c.releaseObjectFinalizers(context.TODO(), key); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove the finalizer from the objects of %s: %w", key, err))
+			continue
+		}
+		c.logger.Info("API removed or no longer selected by placements, stopping informer.", "key", key)
+		// the registry stops the informer
+		c.registry.Remove(key)
+	}
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+	c.watchedSelection = selection
+	return nil
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package placement
+
+import (
+	"testing"
+
+	"github.com/kubestellar/kubestellar/api/edge/v1alpha1"
+)
+
+func TestResourceSelection(t *testing.T) {
+	core := ""
+	apps := "apps"
+
+	selection := resourceSelection{}
+	selection.add(v1alpha1.ObjectTest{APIGroup: &core, Resources: []string{"configmaps"}})
+	selection.add(v1alpha1.ObjectTest{APIGroup: &apps})
+
+	tests := []struct {
+		group, resource string
+		matches         bool
+	}{
+		{"", "configmaps", true},
+		{"", "secrets", false},
+		{"apps", "deployments", true},
+		{"apps", "statefulsets", true},
+		{"batch", "jobs", false},
+	}
+	for _, test := range tests {
+		if matches := selection.matches(test.group, test.resource); matches != test.matches {
+			t.Errorf("%s %s: expected matches=%t, got %t", test.group, test.resource, test.matches, matches)
+		}
+	}
+	if selection.matchesAll() {
+		t.Errorf("expected selection not to match all resources")
+	}
+
+	// a test with no group matches the resources in any group
+	selection.add(v1alpha1.ObjectTest{Resources: []string{"jobs"}})
+	if !selection.matches("batch", "jobs") || selection.matches("batch", "cronjobs") {
+		t.Errorf("expected only jobs to match in any group")
+	}
+
+	selection.add(v1alpha1.ObjectTest{})
+	if !selection.matchesAll() || !selection.matches("batch", "cronjobs") {
+		t.Errorf("expected wildcard test to match all resources")
+	}
+}
@@ -0,0 +1,291 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shard
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	defaultLeaseDuration = 15 * time.Second
+	defaultRenewDeadline = 10 * time.Second
+	defaultRetryPeriod   = 2 * time.Second
+)
+
+// Options configures a Claimer
+type Options struct {
+	// Shards is the number of shards the keys are split into
+	Shards int
+	// MaxShards is the maximum number of shards claimed by this replica. If not
+	// positive, all the shards can be claimed.
+	MaxShards int
+	// Replicas is the expected number of replicas. If positive, a MaxShards with which
+	// the replicas cannot claim all the shards is rejected.
+	Replicas int
+	// Namespace and LeasePrefix locate the Leases of the shards, named <LeasePrefix>-<index>
+	Namespace   string
+	LeasePrefix string
+	// Identity identifies this replica as holder of the Leases
+	Identity string
+}
+
+// Claimer claims shards for this replica by acquiring and renewing their Leases. Every
+// replica contends for the shards until it holds MaxShards of them, so that the shards
+// of a replica that goes away are taken over by the others.
+type Claimer struct {
+	client   kubernetes.Interface
+	opts     Options
+	logger   logr.Logger
+	lock     sync.RWMutex
+	held     sets.Set[int]
+	handlers []func()
+}
+
+// NewClaimer creates a Claimer. Run it with Start.
+func NewClaimer(client kubernetes.Interface, logger logr.Logger, opts Options) (*Claimer, error) {
+	if opts.Shards < 1 {
+		return nil, fmt.Errorf("invalid number of shards: %d", opts.Shards)
+	}
+	if opts.Namespace == "" || opts.LeasePrefix == "" || opts.Identity == "" {
+		return nil, fmt.Errorf("the namespace, lease prefix and identity of the shards are required")
+	}
+	if opts.MaxShards < 1 || opts.MaxShards > opts.Shards {
+		opts.MaxShards = opts.Shards
+	}
+	if opts.Replicas > 0 && opts.Replicas*opts.MaxShards < opts.Shards {
+		return nil, fmt.Errorf("%d replicas claiming at most %d shards each cannot claim all the %d shards",
+			opts.Replicas, opts.MaxShards, opts.Shards)
+	}
+	return &Claimer{
+		client: client,
+		opts:   opts,
+		logger: logger.WithName("shards"),
+		held:   sets.New[int](),
+	}, nil
+}
+
+// Owns returns true if the shard of the key is held by this replica
+func (c *Claimer) Owns(key string) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.held.Has(Index(key, c.opts.Shards))
+}
+
+// Held returns the sorted indexes of the shards held by this replica
+func (c *Claimer) Held() []int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return sets.List(c.held)
+}
+
+// AddChangeHandler adds a function invoked when this replica claims or loses a shard.
+// Handlers are invoked synchronously, so they should not block.
+func (c *Claimer) AddChangeHandler(handler func()) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.handlers = append(c.handlers, handler)
+}
+
+// Start contends for the shards until the context is cancelled, then releases the
+// shards held. It implements manager.Runnable.
+func (c *Claimer) Start(ctx context.Context) error {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.reportUnclaimed(ctx)
+	}()
+	// replicas start contending from different shards, to spread the initial claims
+	first := Index(c.opts.Identity, c.opts.Shards)
+	for i := 0; i < c.opts.Shards; i++ {
+		index := (first + i) % c.opts.Shards
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.contend(ctx, index)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: all the replicas claim shards
+func (c *Claimer) NeedLeaderElection() bool {
+	return false
+}
+
+// contend runs the leader election for the Lease of a shard, as long as this replica
+// has capacity for one more shard
+func (c *Claimer) contend(ctx context.Context, index int) {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Namespace: c.opts.Namespace,
+			Name:      c.leaseName(index),
+		},
+		Client:     c.client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: c.opts.Identity},
+	}
+	for ctx.Err() == nil {
+		if c.full() {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(defaultRetryPeriod):
+			}
+			continue
+		}
+
+		electionCtx, cancel := context.WithCancel(ctx)
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   defaultLeaseDuration,
+			RenewDeadline:   defaultRenewDeadline,
+			RetryPeriod:     defaultRetryPeriod,
+			ReleaseOnCancel: true,
+			Name:            lock.LeaseMeta.Name,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(context.Context) {
+					// another shard may have been claimed in the meantime
+					if !c.claim(index) {
+						cancel()
+					}
+				},
+				OnStoppedLeading: func() {
+					c.release(index)
+				},
+			},
+		})
+		if err != nil {
+			cancel()
+			c.logger.Error(err, "Failed to create the leader elector of a shard", "shard", index)
+			return
+		}
+		elector.Run(electionCtx)
+		cancel()
+	}
+}
+
+// reportUnclaimed periodically counts the shards whose Lease is not held by any replica,
+// e.g. because too few replicas run for their maximum number of shards
+func (c *Claimer) reportUnclaimed(ctx context.Context) {
+	ticker := time.NewTicker(defaultLeaseDuration)
+	defer ticker.Stop()
+	reported := 0
+	for {
+		select {
+		case <-ctx.Done():
+			unclaimedShards.DeleteLabelValues(c.opts.LeasePrefix)
+			return
+		case <-ticker.C:
+		}
+		unclaimed, err := c.countUnclaimed(ctx, time.Now())
+		if err != nil {
+			c.logger.Error(err, "Failed to count the unclaimed shards")
+			continue
+		}
+		unclaimedShards.WithLabelValues(c.opts.LeasePrefix).Set(float64(unclaimed))
+		if unclaimed > 0 && unclaimed != reported {
+			c.logger.Info("Shards are not claimed by any replica, run more replicas or raise the maximum shards per replica",
+				"unclaimed", unclaimed, "of", c.opts.Shards, "maxShardsPerReplica", c.opts.MaxShards)
+		}
+		reported = unclaimed
+	}
+}
+
+// countUnclaimed returns the number of shards whose Lease does not exist, has no holder
+// or has expired
+func (c *Claimer) countUnclaimed(ctx context.Context, now time.Time) (int, error) {
+	leases, err := c.client.CoordinationV1().Leases(c.opts.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return 0, err
+	}
+	claimed := sets.New[string]()
+	for _, lease := range leases.Items {
+		spec := lease.Spec
+		if spec.HolderIdentity == nil || *spec.HolderIdentity == "" || spec.RenewTime == nil {
+			continue
+		}
+		duration := defaultLeaseDuration
+		if spec.LeaseDurationSeconds != nil {
+			duration = time.Duration(*spec.LeaseDurationSeconds) * time.Second
+		}
+		if spec.RenewTime.Add(duration).After(now) {
+			claimed.Insert(lease.Name)
+		}
+	}
+	unclaimed := 0
+	for i := 0; i < c.opts.Shards; i++ {
+		if !claimed.Has(c.leaseName(i)) {
+			unclaimed++
+		}
+	}
+	return unclaimed, nil
+}
+
+func (c *Claimer) leaseName(index int) string {
+	return fmt.Sprintf("%s-%d", c.opts.LeasePrefix, index)
+}
+
+func (c *Claimer) full() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.held.Len() >= c.opts.MaxShards
+}
+
+func (c *Claimer) claim(index int) bool {
+	c.lock.Lock()
+	if c.held.Len() >= c.opts.MaxShards {
+		c.lock.Unlock()
+		return false
+	}
+	c.held.Insert(index)
+	handlers := append([]func(){}, c.handlers...)
+	c.lock.Unlock()
+
+	c.logger.Info("Claimed shard", "shard", index, "of", c.opts.Shards)
+	for _, handler := range handlers {
+		handler()
+	}
+	return true
+}
+
+func (c *Claimer) release(index int) {
+	c.lock.Lock()
+	if !c.held.Has(index) {
+		c.lock.Unlock()
+		return
+	}
+	c.held.Delete(index)
+	handlers := append([]func(){}, c.handlers...)
+	c.lock.Unlock()
+
+	c.logger.Info("Released shard", "shard", index, "of", c.opts.Shards)
+	for _, handler := range handlers {
+		handler()
+	}
+}
@@ -0,0 +1,36 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shard
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// unclaimedShards reports the number of shards whose Lease is not held by any replica,
+// whose keys are not reconciled
+var unclaimedShards = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "kubestellar_shards_unclaimed",
+		Help: "Number of shards whose Lease is not held by any replica, by lease prefix.",
+	},
+	[]string{"lease_prefix"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(unclaimedShards)
+}
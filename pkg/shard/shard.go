@@ -0,0 +1,53 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package shard splits the objects of a WDS across the replicas of a controller.
+// Keys are mapped to shards with a consistent hash, and replicas claim shards by
+// holding a Lease for each of them.
+package shard
+
+import (
+	"hash/fnv"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Index returns the shard of the key, among the given number of shards. It uses jump
+// consistent hashing, so that only a fraction of the keys move when shards are added.
+func Index(key string, shards int) int {
+	if shards <= 1 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	k := h.Sum64()
+	b, j := int64(-1), int64(0)
+	for j < int64(shards) {
+		b = j
+		k = k*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((k>>33)+1)))
+	}
+	return int(b)
+}
+
+// ObjectKey returns the sharding key of an object: objects in a namespace are kept
+// together in the same shard, cluster-scoped objects are sharded by kind
+func ObjectKey(gvk schema.GroupVersionKind, namespace string) string {
+	if namespace != "" {
+		return "namespace/" + namespace
+	}
+	return "kind/" + gvk.GroupKind().String()
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shard
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+)
+
+func TestIndex(t *testing.T) {
+	counts := make([]int, 4)
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("namespace/ns-%d", i)
+		index := Index(key, 4)
+		if index != Index(key, 4) {
+			t.Fatalf("expected the index of %s to be stable", key)
+		}
+		counts[index]++
+		if Index(key, 5) != index {
+			moved++
+		}
+	}
+	for i, count := range counts {
+		if count < 150 {
+			t.Errorf("expected keys to be spread across shards, shard %d has %d", i, count)
+		}
+	}
+	// about a fifth of the keys move to the new shard
+	if moved > 300 {
+		t.Errorf("expected few keys to move when adding a shard, %d moved", moved)
+	}
+	if Index("any", 1) != 0 {
+		t.Errorf("expected a single shard to hold all keys")
+	}
+}
+
+func TestClaimer(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	claimers := []*Claimer{}
+	for _, identity := range []string{"replica-a", "replica-b"} {
+		c, err := NewClaimer(client, logr.Discard(), Options{
+			Shards: 2, MaxShards: 1, Namespace: "kubestellar", LeasePrefix: "wds1-shard", Identity: identity})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		claimers = append(claimers, c)
+		go c.Start(ctx)
+	}
+
+	err := wait.PollUntilContextTimeout(ctx, 100*time.Millisecond, 20*time.Second, true,
+		func(context.Context) (bool, error) {
+			return len(claimers[0].Held()) == 1 && len(claimers[1].Held()) == 1, nil
+		})
+	if err != nil {
+		t.Fatalf("expected each replica to claim a shard, got %v and %v", claimers[0].Held(), claimers[1].Held())
+	}
+	if claimers[0].Held()[0] == claimers[1].Held()[0] {
+		t.Errorf("expected the replicas to claim different shards")
+	}
+	key := "namespace/ns1"
+	if claimers[0].Owns(key) == claimers[1].Owns(key) {
+		t.Errorf("expected exactly one replica to own %s", key)
+	}
+}
+
+func TestClaimerCapacity(t *testing.T) {
+	opts := Options{Shards: 4, Namespace: "kubestellar", LeasePrefix: "wds1-shard", Identity: "replica-a"}
+	c, err := NewClaimer(fake.NewSimpleClientset(), logr.Discard(), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// a single replica claims all the shards by default
+	if c.opts.MaxShards != 4 {
+		t.Errorf("expected the maximum shards to default to the number of shards, got %d", c.opts.MaxShards)
+	}
+
+	opts.Replicas, opts.MaxShards = 2, 1
+	if _, err := NewClaimer(fake.NewSimpleClientset(), logr.Discard(), opts); err == nil {
+		t.Errorf("expected 2 replicas claiming 1 shard each to be rejected for 4 shards")
+	}
+	opts.MaxShards = 2
+	if _, err := NewClaimer(fake.NewSimpleClientset(), logr.Discard(), opts); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestCountUnclaimed(t *testing.T) {
+	now := time.Now()
+	lease := func(index int, holder string, renewed time.Time) *coordinationv1.Lease {
+		return &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kubestellar", Name: fmt.Sprintf("wds1-shard-%d", index)},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       pointer.String(holder),
+				LeaseDurationSeconds: pointer.Int32(15),
+				RenewTime:            &metav1.MicroTime{Time: renewed},
+			},
+		}
+	}
+	client := fake.NewSimpleClientset(
+		lease(0, "replica-a", now),
+		// expired, released and missing Leases are unclaimed
+		lease(1, "replica-b", now.Add(-time.Minute)),
+		lease(2, "", now),
+	)
+	c, err := NewClaimer(client, logr.Discard(), Options{
+		Shards: 4, Namespace: "kubestellar", LeasePrefix: "wds1-shard", Identity: "replica-a"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	unclaimed, err := c.countUnclaimed(context.Background(), now)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if unclaimed != 3 {
+		t.Errorf("expected 3 unclaimed shards, got %d", unclaimed)
+	}
+}
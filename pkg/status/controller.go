@@ -19,14 +19,17 @@ package status
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	"golang.org/x/time/rate"
 
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -40,35 +43,40 @@ import (
 	ctrlm "sigs.k8s.io/controller-runtime/pkg/manager"
 
 	"github.com/kubestellar/kubestellar/api/edge/v1alpha1"
+	"github.com/kubestellar/kubestellar/pkg/informers"
 	"github.com/kubestellar/kubestellar/pkg/util"
 )
 
+// field manager used when writing singleton status to objects in the wds
+const statusFieldManager = "kubestellar-status"
+
 // Status controller watches workstatues and checks associated placements for singleton status. If
 // a placement that cuase an object to be delivered to a cluster has singleton statsus specified
-// the full status will be copied to the object.
+// the full status will be copied to the object. The reported status is read from a Source, which
+// is either the WorkStatuses of the status add-on or the status feedback of the ManifestWorks.
 type Controller struct {
-	ctx                context.Context
-	logger             logr.Logger
-	wdsName            string
-	wdsDynClient       *dynamic.DynamicClient
-	wdsKubeClient      *kubernetes.Clientset
-	imbsDynClient      *dynamic.DynamicClient
-	imbsKubeClient     *kubernetes.Clientset
-	workStatusInformer cache.SharedIndexInformer
-	workStatusLister   cache.GenericLister
-	placementInformer  cache.SharedIndexInformer
-	placementLister    cache.GenericLister
-	workqueue          workqueue.RateLimitingInterface
+	logger            logr.Logger
+	wdsName           string
+	wdsDynClient      *dynamic.DynamicClient
+	wdsKubeClient     *kubernetes.Clientset
+	imbsDynClient     *dynamic.DynamicClient
+	imbsKubeClient    *kubernetes.Clientset
+	statusSource      Source
+	placementInformer cache.SharedIndexInformer
+	placementLister   cache.GenericLister
+	workqueue         workqueue.RateLimitingInterface
 	// all wds listers/informers are required to retrieve objects and update status
-	// without having to re-create new caches for this coontroller
-	listers   map[string]*cache.GenericLister
-	informers map[string]*cache.SharedIndexInformer
+	// without having to re-create new caches for this coontroller. The registry is
+	// shared with the placement controller, which adds and removes informers as
+	// API resources are added or removed.
+	registry *informers.Registry
+	// number of workers processing the workqueue
+	workers int
 }
 
 // Create a new  status controller
 func NewController(mgr ctrlm.Manager, wdsRestConfig *rest.Config, imbsRestConfig *rest.Config,
-	wdsName string, listers map[string]*cache.GenericLister,
-	informers map[string]*cache.SharedIndexInformer) (*Controller, error) {
+	wdsName string, registry *informers.Registry, statusSource Source, workers int) (*Controller, error) {
 	ratelimiter := workqueue.NewMaxOfRateLimiter(
 		workqueue.NewItemExponentialFailureRateLimiter(5*time.Millisecond, 1000*time.Second),
 		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(50), 300)},
@@ -102,44 +110,40 @@ func NewController(mgr ctrlm.Manager, wdsRestConfig *rest.Config, imbsRestConfig
 		imbsDynClient:  imbsDynClient,
 		imbsKubeClient: imbsKubeClient,
 		workqueue:      workqueue.NewRateLimitingQueue(ratelimiter),
-		listers:        listers,
-		informers:      informers,
+		registry:       registry,
+		statusSource:   statusSource,
+		workers:        workers,
 	}
 
-	return controller, nil
-}
+	// add the event handler functions
+	statusSource.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handleObject,
+		UpdateFunc: func(old, new interface{}) {
+			if shouldSkipUpdate(old, new) {
+				return
+			}
+			controller.handleObject(new)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if shouldSkipDelete(obj) {
+				return
+			}
+			controller.handleObject(obj)
+		},
+	})
 
-// Start the status controller
-func (c *Controller) Start(workers int) error {
-	ctx, cancel := context.WithCancel(context.Background())
-	c.ctx = ctx
-	defer cancel()
-
-	errChan := make(chan error, 1)
-	go func() {
-		errChan <- c.run(workers)
-	}()
-
-	// check for errors at startup, after all started we let it continue
-	// so we can start the controller-runtime manager
-	select {
-	case err := <-errChan:
-		return err
-	case <-time.After(3 * time.Second):
-		return nil
-	}
+	return controller, nil
 }
 
-// Invoked by Start() to run the translator
-func (c *Controller) run(workers int) error {
+// Start runs the status controller until the context is cancelled. The controller is a
+// manager.Runnable, so it is started by the manager once this replica is elected leader
+// and stopped with the manager. On shutdown, the workqueue is drained.
+func (c *Controller) Start(ctx context.Context) error {
 	defer c.workqueue.ShutDown()
 
 	// start informers
-	go c.startPlacementInformer()
-	go c.startWorkStatusInformer()
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	c.startPlacementInformer(ctx)
+	go c.statusSource.Run(ctx)
 
 	// wait for all informers caches to be synced
 	c.logger.Info("waiting for caches to sync")
@@ -147,38 +151,63 @@ func (c *Controller) run(workers int) error {
 	// we can't use cache.WaitForCacheSync here because informers are started by the placement controllers
 	// and may not be started yet, thus WaitForCacheSync throws an exception. PollUntilContextCancel is
 	// a safer approach here.
-	for _, informer := range c.informers {
-		wait.PollUntilContextCancel(ctx, time.Second, true, func(ctx context.Context) (bool, error) {
-			if informer != nil && (*informer).HasSynced() {
-				return true, nil
-			}
-			return false, nil
-		})
+	for _, key := range c.registry.Keys() {
+		c.waitForKindSynced(ctx, key)
 	}
 
 	if ok := cache.WaitForCacheSync(ctx.Done(), (c.placementInformer).HasSynced); !ok {
 		return fmt.Errorf("failed to wait for placement caches to sync")
 	}
 
-	if ok := cache.WaitForCacheSync(ctx.Done(), (c.workStatusInformer).HasSynced); !ok {
-		return fmt.Errorf("failed to wait for workstatus caches to sync")
+	if ok := cache.WaitForCacheSync(ctx.Done(), c.statusSource.HasSynced); !ok {
+		return fmt.Errorf("failed to wait for status source caches to sync")
 	}
 
 	c.logger.Info("All caches synced")
 
-	c.logger.Info("Starting workers", "count", workers)
-	for i := 0; i < workers; i++ {
-		go wait.UntilWithContext(ctx, c.runWorker, time.Second)
+	// track kinds added or removed after startup (e.g. new CRDs), so that
+	// workstatuses for objects of those kinds get processed when their cache is ready
+	c.registry.Subscribe(informers.Subscriber{
+		AddFunc: func(key string) {
+			go c.handleKindAdded(ctx, key)
+		},
+		RemoveFunc: c.handleKindRemoved,
+	})
+
+	c.logger.Info("Starting workers", "count", c.workers)
+	// the workers do not use the manager context, so that the items taken from the
+	// workqueue when the controller is stopped are processed to completion
+	workerCtx, cancelWorkers := context.WithCancel(context.Background())
+	defer cancelWorkers()
+	var workersDone sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		workersDone.Add(1)
+		go func() {
+			defer workersDone.Done()
+			c.runWorker(workerCtx)
+		}()
 	}
 	c.logger.Info("Started workers")
 
 	<-ctx.Done()
-	c.logger.Info("Shutting down workers")
+	c.logger.Info("Shutting down workers, draining the workqueue")
+	c.workqueue.ShutDownWithDrain()
+	workersDone.Wait()
+	c.logger.Info("Workers stopped")
 
 	return nil
 }
 
-func (c *Controller) startPlacementInformer() {
+var _ ctrlm.LeaderElectionRunnable = &Controller{}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable: only the leader
+// writes status to the WDS objects
+func (c *Controller) NeedLeaderElection() bool {
+	return true
+}
+
+// starts the placement informer, which runs until the context is cancelled
+func (c *Controller) startPlacementInformer(ctx context.Context) {
 	informerFactory := dynamicinformer.NewDynamicSharedInformerFactory(c.wdsDynClient, 0*time.Minute)
 
 	gvr := schema.GroupVersionResource{Group: v1alpha1.GroupVersion.Group,
@@ -188,45 +217,19 @@ func (c *Controller) startPlacementInformer() {
 	c.placementInformer = informerFactory.ForResource(gvr).Informer()
 	c.placementLister = cache.NewGenericLister(c.placementInformer.GetIndexer(), gvr.GroupResource())
 
-	stopper := make(chan struct{})
-	defer close(stopper)
-	informerFactory.Start(stopper)
-
-	<-stopper
-}
-
-func (c *Controller) startWorkStatusInformer() {
-	informerFactory := dynamicinformer.NewDynamicSharedInformerFactory(c.imbsDynClient, 0*time.Minute)
-
-	gvr := schema.GroupVersionResource{Group: util.WorkStatusGroup,
-		Version:  util.WorkStatusVersion,
-		Resource: util.WorkStatusResource}
-
-	c.workStatusInformer = informerFactory.ForResource(gvr).Informer()
-	c.workStatusLister = cache.NewGenericLister(c.workStatusInformer.GetIndexer(), gvr.GroupResource())
-
-	// add the event handler functions
-	c.workStatusInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: c.handleObject,
+	// evaluate the health of placements when created or when their spec changes;
+	// changes to status only (including the ones made by this controller) are ignored
+	c.placementInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueuePlacement,
 		UpdateFunc: func(old, new interface{}) {
-			if shouldSkipUpdate(old, new) {
-				return
-			}
-			c.handleObject(new)
-		},
-		DeleteFunc: func(obj interface{}) {
-			if shouldSkipDelete(obj) {
+			if old.(metav1.Object).GetGeneration() == new.(metav1.Object).GetGeneration() {
 				return
 			}
-			c.handleObject(obj)
+			c.enqueuePlacement(new)
 		},
 	})
 
-	stopper := make(chan struct{})
-	defer close(stopper)
-	informerFactory.Start(stopper)
-
-	<-stopper
+	informerFactory.Start(ctx.Done())
 }
 
 func shouldSkipUpdate(old, new interface{}) bool {
@@ -249,6 +252,11 @@ func (c *Controller) handleObject(obj any) {
 	gvk := ok.GroupVersionKind()
 	c.logger.V(2).Info("Got object event", gvk.GroupVersion().String(), gvk.Kind, mObj.GetNamespace(), mObj.GetName())
 	c.enqueueObject(obj)
+	c.enqueuePlacementsForWorkStatus(obj)
+}
+
+func (c *Controller) enqueuePlacement(obj interface{}) {
+	c.workqueue.Add(placementRef(obj.(metav1.Object).GetName()))
 }
 
 // enqueueObject generates key and put it onto the work queue.
@@ -261,6 +269,42 @@ func (c *Controller) enqueueObject(obj interface{}) {
 	c.workqueue.Add(ref)
 }
 
+// waits until the informer for the given kind key has synced. Returns false if the
+// kind was removed from the registry or the context was cancelled before sync.
+func (c *Controller) waitForKindSynced(ctx context.Context, key string) bool {
+	err := wait.PollUntilContextCancel(ctx, time.Second, true, func(ctx context.Context) (bool, error) {
+		if !c.registry.Has(key) {
+			return false, fmt.Errorf("informer for %s was removed", key)
+		}
+		return c.registry.HasSynced(key), nil
+	})
+	return err == nil
+}
+
+// handleKindAdded waits for the cache of a newly added kind to sync and then
+// requeues the singleton workstatuses referencing objects of that kind
+func (c *Controller) handleKindAdded(ctx context.Context, key string) {
+	if !c.waitForKindSynced(ctx, key) {
+		return
+	}
+	list, err := c.statusSource.List(labels.SelectorFromSet(labels.Set{
+		util.PlacementLabelSingletonStatus: util.PlacementLabelValueEnabled}))
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	for _, reported := range list {
+		sourceRef := reported.SourceRef
+		if util.KeyForGroupVersionKind(sourceRef.Group, sourceRef.Version, sourceRef.Kind) == key {
+			c.workqueue.Add(cache.ObjectName{Namespace: reported.Namespace, Name: reported.Name})
+		}
+	}
+}
+
+func (c *Controller) handleKindRemoved(key string) {
+	c.logger.Info("API removed, singleton status no longer tracked", "key", key)
+}
+
 // runWorker is a long-running function that will continually call the
 // processNextWorkItem function in order to read and process a message on the
 // workqueue.
@@ -287,20 +331,25 @@ func (c *Controller) processNextWorkItem(ctx context.Context) bool {
 		// period.
 		defer c.workqueue.Done(obj)
 
-		// We expect a cache.ObjectName to come off the workqueue. We do this as the delayed
+		// We expect a cache.ObjectName for workstatuses, or a placementRef for placements
+		// requiring health evaluation, to come off the workqueue. We do this as the delayed
 		// nature of the workqueue means the items in the informer cache may actually be
 		// more up to date that when the item was initially put onto the
 		// workqueue.
-		ref, ok := obj.(cache.ObjectName)
-		if !ok {
+		var err error
+		switch ref := obj.(type) {
+		case cache.ObjectName:
+			err = c.reconcile(ctx, ref)
+		case placementRef:
+			err = c.reconcilePlacementHealth(ctx, string(ref))
+		default:
 			// if the item in the workqueue is invalid, we call
 			// Forget here to avoid process a work item that is invalid.
 			c.workqueue.Forget(obj)
-			utilruntime.HandleError(fmt.Errorf("expected a string key in the workqueue but got %#v", obj))
+			utilruntime.HandleError(fmt.Errorf("expected a cache.ObjectName or placementRef in the workqueue but got %#v", obj))
 			return nil
 		}
-		// Run the reconciler, passing it the full key or the metav1 Object
-		if err := c.reconcile(ctx, ref); err != nil {
+		if err != nil {
 			// Put the item back on the workqueue to handle any transient errors.
 			c.workqueue.AddRateLimited(obj)
 			return fmt.Errorf("error syncing key '%s': %s, requeuing", obj, err.Error())
@@ -321,7 +370,7 @@ func (c *Controller) processNextWorkItem(ctx context.Context) bool {
 }
 
 func (c *Controller) reconcile(ctx context.Context, ref cache.ObjectName) error {
-	obj, err := getObject(c.workStatusLister, ref.Namespace, ref.Name)
+	reported, err := c.statusSource.Get(ref.Namespace, ref.Name)
 	if err != nil {
 		// The resource no longer exist, which means it has been deleted.
 		if errors.IsNotFound(err) {
@@ -331,37 +380,44 @@ func (c *Controller) reconcile(ctx context.Context, ref cache.ObjectName) error
 		return err
 	}
 
-	// only process workstatues with the label for single reported status
-	if _, ok := obj.(metav1.Object).GetLabels()[util.PlacementLabelSingletonStatus]; !ok {
+	// only process workstatuses owned by this wds. The informer already filters them
+	// with a label selector, this guards against updating objects from another wds.
+	if !util.IsOwnedByWDS(reported.Labels, c.wdsName) {
 		return nil
 	}
 
-	sourceRef, err := util.GetWorkStatusSourceRef(obj)
-	if err != nil {
-		return err
+	// only process workstatues with the label for single reported status
+	if _, ok := reported.Labels[util.PlacementLabelSingletonStatus]; !ok {
+		return nil
 	}
 
-	status, err := util.GetWorkStatusStatus(obj)
-	if err != nil {
+	sourceRef := reported.SourceRef
+	status := reported.Status
+	if status == nil {
 		// status gets updated after workstatus is created, it's ok to requeue
-		return err
+		return fmt.Errorf("could not find status in object %s", reported.Name)
 	}
 
 	c.logger.Info("updating singleton status", "kind", sourceRef.Kind, "name", sourceRef.Name, "namespace", sourceRef.Namespace)
-	return updateObjectStatus(sourceRef, status, c.listers, c.wdsDynClient)
+	key := util.KeyForGroupVersionKind(sourceRef.Group, sourceRef.Version, sourceRef.Kind)
+	if !c.registry.HasSynced(key) {
+		// the workstatus is requeued by handleKindAdded once the cache for the kind is ready
+		c.logger.Info("cache for kind not available yet, waiting for it to sync", "key", key)
+		return nil
+	}
+
+	return updateObjectStatus(ctx, sourceRef, status, c.registry, c.wdsDynClient)
 }
 
-func updateObjectStatus(objRef *util.SourceRef, status map[string]interface{},
-	listers map[string]*cache.GenericLister, wdsDynClient *dynamic.DynamicClient) error {
+// updateObjectStatus writes the reported status to the object in the WDS using server-side
+// apply on the status subresource, so that there is no need to send the full object with
+// its resourceVersion. The write is skipped when the status is semantically unchanged.
+func updateObjectStatus(ctx context.Context, objRef *util.SourceRef, status map[string]interface{},
+	registry *informers.Registry, wdsDynClient dynamic.Interface) error {
 
 	key := util.KeyForGroupVersionKind(objRef.Group, objRef.Version, objRef.Kind)
 
-	lister, ok := listers[key]
-	if !ok {
-		return fmt.Errorf("could not find lister for GVK key %s", key)
-	}
-
-	obj, err := getObject(*lister, objRef.Namespace, objRef.Name)
+	obj, err := registry.GetObject(ctx, key, objRef.Namespace, objRef.Name)
 	if err != nil {
 		return err
 	}
@@ -371,18 +427,43 @@ func updateObjectStatus(objRef *util.SourceRef, status map[string]interface{},
 		return fmt.Errorf("object cannot be cast to *unstructured.Unstructured: object: %s", util.GenerateObjectInfoString(obj))
 	}
 
-	// set the status and update the object
-	unstrObj.Object["status"] = status
-
 	gvr := schema.GroupVersionResource{Group: objRef.Group, Version: objRef.Version, Resource: objRef.Resource}
-	if objRef.Namespace == "" {
-		_, err = wdsDynClient.Resource(gvr).UpdateStatus(context.Background(), unstrObj, metav1.UpdateOptions{})
-	} else {
-		_, err = wdsDynClient.Resource(gvr).Namespace(objRef.Namespace).UpdateStatus(context.Background(), unstrObj, metav1.UpdateOptions{})
+	var resource dynamic.ResourceInterface = wdsDynClient.Resource(gvr)
+	if objRef.Namespace != "" {
+		resource = wdsDynClient.Resource(gvr).Namespace(objRef.Namespace)
+	}
+	return writeObjectStatus(ctx, resource, unstrObj, status)
+}
+
+// writeObjectStatus applies the status to the object unless it is unchanged. The apply is
+// first made without force, so that the conflicts with the other field managers of the
+// status are counted, and then forced as the reported status is authoritative.
+func writeObjectStatus(ctx context.Context, resource dynamic.ResourceInterface, obj *unstructured.Unstructured,
+	status map[string]interface{}) error {
+	if equality.Semantic.DeepEqual(obj.Object["status"], status) {
+		statusWrites.WithLabelValues(writeResultSkipped).Inc()
+		return nil
+	}
+
+	// the apply configuration only carries the identity of the object and its status
+	applyObj := &unstructured.Unstructured{}
+	applyObj.SetAPIVersion(obj.GetAPIVersion())
+	applyObj.SetKind(obj.GetKind())
+	applyObj.SetName(obj.GetName())
+	applyObj.SetNamespace(obj.GetNamespace())
+	applyObj.Object["status"] = status
+
+	_, err := resource.ApplyStatus(ctx, applyObj.GetName(), applyObj, metav1.ApplyOptions{FieldManager: statusFieldManager})
+	if errors.IsConflict(err) {
+		statusWriteConflicts.Inc()
+		_, err = resource.ApplyStatus(ctx, applyObj.GetName(), applyObj,
+			metav1.ApplyOptions{FieldManager: statusFieldManager, Force: true})
 	}
 	if err != nil {
+		statusWrites.WithLabelValues(writeResultError).Inc()
 		return fmt.Errorf("failed to update status: %w", err)
 	}
+	statusWrites.WithLabelValues(writeResultUpdated).Inc()
 
 	return nil
 }
@@ -0,0 +1,74 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestWriteObjectStatus(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "DeploymentList"})
+	applies := 0
+	client.PrependReactor("patch", "deployments", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		applies++
+		// the first apply conflicts with another field manager
+		if applies == 1 {
+			return true, nil, errors.NewConflict(gvr.GroupResource(), "d", nil)
+		}
+		return true, &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1", "kind": "Deployment"}}, nil
+	})
+	resource := client.Resource(gvr).Namespace("ns1")
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "d", "namespace": "ns1"},
+		"status":     map[string]interface{}{"readyReplicas": int64(1)},
+	}}
+
+	skipped := testutil.ToFloat64(statusWrites.WithLabelValues(writeResultSkipped))
+	if err := writeObjectStatus(context.Background(), resource, obj, map[string]interface{}{"readyReplicas": int64(1)}); err != nil {
+		t.Fatal(err)
+	}
+	if applies != 0 || testutil.ToFloat64(statusWrites.WithLabelValues(writeResultSkipped))-skipped != 1 {
+		t.Errorf("expected the unchanged status to be skipped, got %d applies", applies)
+	}
+
+	conflicts := testutil.ToFloat64(statusWriteConflicts)
+	if err := writeObjectStatus(context.Background(), resource, obj, map[string]interface{}{"readyReplicas": int64(2)}); err != nil {
+		t.Fatal(err)
+	}
+	if applies != 2 {
+		t.Errorf("expected the conflicting apply to be forced, got %d applies", applies)
+	}
+	if testutil.ToFloat64(statusWriteConflicts)-conflicts != 1 {
+		t.Errorf("expected the conflict to be counted")
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kubestellar/kubestellar/api/edge/v1alpha1"
+	"github.com/kubestellar/kubestellar/pkg/health"
+	"github.com/kubestellar/kubestellar/pkg/util"
+)
+
+// placementRef is the workqueue item used to request the evaluation of the
+// health of the objects delivered by a placement
+type placementRef string
+
+// enqueue the placements of this WDS that manage the workstatus, so that
+// their health is re-evaluated
+func (c *Controller) enqueuePlacementsForWorkStatus(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	mObj, ok := obj.(metav1.Object)
+	if !ok {
+		return
+	}
+	for _, name := range util.GetPlacementNamesFromLabels(mObj.GetLabels(), c.wdsName) {
+		c.workqueue.Add(placementRef(name))
+	}
+}
+
+// reconcilePlacementHealth assesses the health of all the objects delivered by the
+// placement from their workstatuses, and reports it in the placement status as
+// per-cluster health and as the `Ready` condition.
+func (c *Controller) reconcilePlacementHealth(ctx context.Context, name string) error {
+	obj, err := c.placementLister.Get(name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	placement, err := runtimeObjectToPlacement(obj)
+	if err != nil {
+		return err
+	}
+	if placement.GetDeletionTimestamp() != nil {
+		return nil
+	}
+
+	labelKey := util.GenerateManagedByPlacementLabelKey(c.wdsName, name)
+	list, err := c.statusSource.List(labels.SelectorFromSet(labels.Set{labelKey: util.PlacementLabelValueEnabled}))
+	if err != nil {
+		return err
+	}
+
+	// the namespace of the reported status is the mailbox namespace of the cluster
+	summaries := map[string]*health.Summary{}
+	total := health.Summary{}
+	for _, reported := range list {
+		cluster := reported.Namespace
+		summary, ok := summaries[cluster]
+		if !ok {
+			summary = &health.Summary{}
+			summaries[cluster] = summary
+		}
+		objName, result := c.assessReportedStatus(ctx, reported)
+		summary.Add(objName, result)
+		total.Add(fmt.Sprintf("%s on %s", objName, cluster), result)
+	}
+
+	clusterHealth := make([]v1alpha1.ClusterHealth, 0, len(summaries))
+	for cluster, summary := range summaries {
+		clusterHealth = append(clusterHealth, v1alpha1.ClusterHealth{
+			Cluster:     cluster,
+			Health:      summary.Status(),
+			Healthy:     summary.Healthy,
+			Progressing: summary.Progressing,
+			Degraded:    summary.Degraded,
+			Unknown:     summary.Unknown,
+			Message:     summary.Message,
+		})
+	}
+	sort.Slice(clusterHealth, func(i, j int) bool {
+		return clusterHealth[i].Cluster < clusterHealth[j].Cluster
+	})
+
+	var readyCondition v1alpha1.PlacementCondition
+	switch total.Status() {
+	case v1alpha1.HealthHealthy:
+		readyCondition = v1alpha1.ConditionAvailable()
+		readyCondition.Message = fmt.Sprintf("%d of %d objects healthy", total.Healthy, total.Total())
+	case v1alpha1.HealthUnknown:
+		readyCondition = v1alpha1.ConditionUnavailable()
+		if total.Total() == 0 {
+			readyCondition.Message = "no objects delivered"
+		} else {
+			readyCondition.Message = "health of delivered objects is unknown"
+		}
+	default:
+		readyCondition = v1alpha1.ConditionUnavailable()
+		readyCondition.Message = fmt.Sprintf("%d of %d objects healthy; %s", total.Healthy, total.Total(), total.Message)
+	}
+
+	return c.updatePlacementHealth(ctx, placement, readyCondition, clusterHealth)
+}
+
+// returns a name for the object referenced by the reported status and the result of its health assessment
+func (c *Controller) assessReportedStatus(ctx context.Context, reported *ReportedStatus) (string, health.Result) {
+	sourceRef := reported.SourceRef
+	objName := fmt.Sprintf("%s %s", sourceRef.Kind, sourceRef.Name)
+	if sourceRef.Namespace != "" {
+		objName = fmt.Sprintf("%s %s/%s", sourceRef.Kind, sourceRef.Namespace, sourceRef.Name)
+	}
+
+	status := reported.Status
+	if status == nil {
+		// status not reported yet
+		status = map[string]interface{}{}
+	}
+
+	// the object in the WDS provides the desired state, if available. The informers only
+	// cache metadata, so it is fetched only for the kinds whose assessor needs it.
+	gk := schema.GroupKind{Group: sourceRef.Group, Kind: sourceRef.Kind}
+	var wdsObj *unstructured.Unstructured
+	if health.NeedsObject(gk) {
+		key := util.KeyForGroupVersionKind(sourceRef.Group, sourceRef.Version, sourceRef.Kind)
+		if obj, err := c.registry.GetObject(ctx, key, sourceRef.Namespace, sourceRef.Name); err == nil {
+			wdsObj, _ = obj.(*unstructured.Unstructured)
+		}
+	}
+
+	return objName, health.Assess(gk, wdsObj, status)
+}
+
+// update the placement status only when the reported health changed
+func (c *Controller) updatePlacementHealth(ctx context.Context, placement *v1alpha1.Placement,
+	readyCondition v1alpha1.PlacementCondition, clusterHealth []v1alpha1.ClusterHealth) error {
+	conditionChanged := true
+	for _, existing := range placement.Status.Conditions {
+		if existing.Type == readyCondition.Type && v1alpha1.AreConditionsEqual(existing, readyCondition) {
+			conditionChanged = false
+		}
+	}
+	if !conditionChanged && reflect.DeepEqual(placement.Status.ClusterHealth, clusterHealth) {
+		return nil
+	}
+
+	if conditionChanged {
+		v1alpha1.EnsureCondition(placement, readyCondition)
+	}
+	if len(clusterHealth) == 0 {
+		clusterHealth = nil
+	}
+	placement.Status.ClusterHealth = clusterHealth
+	placement.Status.ObservedGeneration = placement.GetGeneration()
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(placement)
+	if err != nil {
+		return err
+	}
+	gvr := schema.GroupVersionResource{Group: v1alpha1.GroupVersion.Group,
+		Version:  v1alpha1.GroupVersion.Version,
+		Resource: util.PlacementResource}
+	_, err = c.wdsDynClient.Resource(gvr).UpdateStatus(ctx, &unstructured.Unstructured{Object: content}, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update placement status: %w", err)
+	}
+	return nil
+}
+
+func runtimeObjectToPlacement(obj runtime.Object) (*v1alpha1.Placement, error) {
+	unstructuredObj, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("failed to convert runtime.Object to unstructured.Unstructured")
+	}
+	placement := &v1alpha1.Placement{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredObj.UnstructuredContent(), placement); err != nil {
+		return nil, err
+	}
+	return placement, nil
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	writeResultUpdated = "updated"
+	writeResultSkipped = "skipped"
+	writeResultError   = "error"
+)
+
+var (
+	// statusWrites counts the singleton status writes to WDS objects by result
+	statusWrites = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kubestellar_status_writes_total",
+			Help: "Number of singleton status writes to WDS objects, by result (updated, skipped, error).",
+		},
+		[]string{"result"},
+	)
+
+	// statusWriteConflicts counts the status writes conflicting with other field managers
+	statusWriteConflicts = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kubestellar_status_write_conflicts_total",
+			Help: "Number of singleton status writes to WDS objects conflicting with other field managers, then forced.",
+		},
+	)
+)
+
+func init() {
+	// register with the controller-runtime registry, served by the manager metrics endpoint
+	metrics.Registry.MustRegister(statusWrites, statusWriteConflicts)
+}
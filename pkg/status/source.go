@@ -0,0 +1,254 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	workv1 "open-cluster-management.io/api/work/v1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kubestellar/kubestellar/pkg/util"
+)
+
+// ReportedStatus is the status reported from a WEC for an object delivered by the
+// placement controller, together with the reference to the source object in the WDS.
+type ReportedStatus struct {
+	// Name and Namespace of the object carrying the status in the IMBS.
+	// The namespace is the mailbox namespace of the cluster.
+	Name      string
+	Namespace string
+	// Labels of the object carrying the status, including the managed-by placement labels
+	Labels    map[string]string
+	SourceRef *util.SourceRef
+	// Status is nil if no status has been reported yet
+	Status map[string]interface{}
+}
+
+// Source is a source of the status reported for delivered objects. Implementations
+// are backed by an informer on the IMBS, whose objects carry the managed-by labels.
+type Source interface {
+	// AddEventHandler adds a handler for the events of the objects carrying the status
+	AddEventHandler(handler cache.ResourceEventHandler)
+	// Run starts the informer and blocks until the context is done
+	Run(ctx context.Context)
+	HasSynced() bool
+	Get(namespace, name string) (*ReportedStatus, error)
+	List(selector labels.Selector) ([]*ReportedStatus, error)
+}
+
+type informerSource struct {
+	informer cache.SharedIndexInformer
+	lister   cache.GenericLister
+	factory  dynamicinformer.DynamicSharedInformerFactory
+	convert  func(obj runtime.Object) (*ReportedStatus, error)
+}
+
+// the informer only caches the objects owned by the given wds, using a server-side label
+// selector, so that multiple wds sharing the same imbs do not see each other's objects
+func newInformerSource(imbsRestConfig *rest.Config, wdsName string, gvr schema.GroupVersionResource,
+	convert func(obj runtime.Object) (*ReportedStatus, error)) (*informerSource, error) {
+	imbsDynClient, err := dynamic.NewForConfig(imbsRestConfig)
+	if err != nil {
+		return nil, err
+	}
+	selector := util.SelectorForWDS(wdsName).String()
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(imbsDynClient, 0*time.Minute,
+		metav1.NamespaceAll, func(options *metav1.ListOptions) {
+			options.LabelSelector = selector
+		})
+	informer := factory.ForResource(gvr).Informer()
+	return &informerSource{
+		informer: informer,
+		lister:   cache.NewGenericLister(informer.GetIndexer(), gvr.GroupResource()),
+		factory:  factory,
+		convert:  convert,
+	}, nil
+}
+
+func (s *informerSource) AddEventHandler(handler cache.ResourceEventHandler) {
+	s.informer.AddEventHandler(handler)
+}
+
+func (s *informerSource) Run(ctx context.Context) {
+	s.factory.Start(ctx.Done())
+	<-ctx.Done()
+}
+
+func (s *informerSource) HasSynced() bool {
+	return s.informer.HasSynced()
+}
+
+func (s *informerSource) Get(namespace, name string) (*ReportedStatus, error) {
+	obj, err := getObject(s.lister, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.convert(obj)
+}
+
+func (s *informerSource) List(selector labels.Selector) ([]*ReportedStatus, error) {
+	objs, err := s.lister.List(selector)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*ReportedStatus, 0, len(objs))
+	for _, obj := range objs {
+		reported, err := s.convert(obj)
+		if err != nil {
+			continue
+		}
+		list = append(list, reported)
+	}
+	return list, nil
+}
+
+// NewWorkStatusSource creates a source reading the WorkStatus objects created by the status add-on
+func NewWorkStatusSource(imbsRestConfig *rest.Config, wdsName string) (Source, error) {
+	gvr := schema.GroupVersionResource{Group: util.WorkStatusGroup,
+		Version:  util.WorkStatusVersion,
+		Resource: util.WorkStatusResource}
+	return newInformerSource(imbsRestConfig, wdsName, gvr, workStatusToReportedStatus)
+}
+
+func workStatusToReportedStatus(obj runtime.Object) (*ReportedStatus, error) {
+	sourceRef, err := util.GetWorkStatusSourceRef(obj)
+	if err != nil {
+		return nil, err
+	}
+	mObj := obj.(metav1.Object)
+	reported := &ReportedStatus{
+		Name:      mObj.GetName(),
+		Namespace: mObj.GetNamespace(),
+		Labels:    mObj.GetLabels(),
+		SourceRef: sourceRef,
+	}
+	// status gets updated after workstatus is created
+	if status, err := util.GetWorkStatusStatus(obj); err == nil {
+		reported.Status = status
+	}
+	return reported, nil
+}
+
+// NewManifestWorkSource creates a source reading the status feedback returned by the OCM
+// work agent in the ManifestWorks. It is used when the status add-on is not available;
+// the feedback rules are set by the placement controller when wrapping the objects.
+func NewManifestWorkSource(imbsRestConfig *rest.Config, wdsName string) (Source, error) {
+	gvr := workv1.GroupVersion.WithResource("manifestworks")
+	return newInformerSource(imbsRestConfig, wdsName, gvr, manifestWorkToReportedStatus)
+}
+
+func manifestWorkToReportedStatus(obj runtime.Object) (*ReportedStatus, error) {
+	uObj, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("object cannot be cast to *unstructured.Unstructured")
+	}
+	manifestWork := &workv1.ManifestWork{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(uObj.UnstructuredContent(), manifestWork); err != nil {
+		return nil, err
+	}
+	reported := &ReportedStatus{
+		Name:      manifestWork.Name,
+		Namespace: manifestWork.Namespace,
+		Labels:    manifestWork.Labels,
+	}
+
+	// the manifestwork wraps a single object, whose resource meta is reported
+	// in the status once the work agent has applied it
+	for _, manifest := range manifestWork.Status.ResourceStatus.Manifests {
+		meta := manifest.ResourceMeta
+		reported.SourceRef = &util.SourceRef{
+			Group:     meta.Group,
+			Version:   meta.Version,
+			Resource:  meta.Resource,
+			Kind:      meta.Kind,
+			Name:      meta.Name,
+			Namespace: meta.Namespace,
+		}
+		if len(manifest.StatusFeedbacks.Values) > 0 {
+			reported.Status = feedbackToStatus(manifest.StatusFeedbacks.Values)
+		}
+		return reported, nil
+	}
+	return nil, fmt.Errorf("no resource status reported yet for manifestwork %s/%s", manifestWork.Namespace, manifestWork.Name)
+}
+
+// builds a status from the feedback values. The values returned for JSONPaths rules are
+// named after the status fields, while well-known status values are capitalized
+// (e.g. ReadyReplicas) and are only used if not returned by JSONPaths rules.
+func feedbackToStatus(values []workv1.FeedbackValue) map[string]interface{} {
+	status := map[string]interface{}{}
+	wellKnown := map[string]interface{}{}
+	for _, v := range values {
+		value, ok := fieldValue(v.Value)
+		if !ok {
+			continue
+		}
+		if v.Name == "" {
+			continue
+		}
+		if first := v.Name[:1]; first == strings.ToUpper(first) {
+			wellKnown[strings.ToLower(first)+v.Name[1:]] = value
+			continue
+		}
+		status[v.Name] = value
+	}
+	for name, value := range wellKnown {
+		if _, found := status[name]; !found {
+			status[name] = value
+		}
+	}
+	return status
+}
+
+func fieldValue(v workv1.FieldValue) (interface{}, bool) {
+	switch v.Type {
+	case workv1.Integer:
+		if v.Integer != nil {
+			return *v.Integer, true
+		}
+	case workv1.String:
+		if v.String != nil {
+			return *v.String, true
+		}
+	case workv1.Boolean:
+		if v.Boolean != nil {
+			return *v.Boolean, true
+		}
+	case workv1.JsonRaw:
+		if v.JsonRaw != nil {
+			var value interface{}
+			if err := json.Unmarshal([]byte(*v.JsonRaw), &value); err == nil {
+				return value, true
+			}
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package status
+
+import (
+	"reflect"
+	"testing"
+
+	workv1 "open-cluster-management.io/api/work/v1"
+)
+
+func TestFeedbackToStatus(t *testing.T) {
+	three := int64(3)
+	two := int64(2)
+	conditions := `[{"type":"Available","status":"True"}]`
+	values := []workv1.FeedbackValue{
+		{Name: "ReadyReplicas", Value: workv1.FieldValue{Type: workv1.Integer, Integer: &two}},
+		{Name: "readyReplicas", Value: workv1.FieldValue{Type: workv1.Integer, Integer: &three}},
+		{Name: "Replicas", Value: workv1.FieldValue{Type: workv1.Integer, Integer: &three}},
+		{Name: "conditions", Value: workv1.FieldValue{Type: workv1.JsonRaw, JsonRaw: &conditions}},
+		{Name: "phase", Value: workv1.FieldValue{Type: workv1.String}},
+	}
+
+	expected := map[string]interface{}{
+		"readyReplicas": int64(3),
+		"replicas":      int64(3),
+		"conditions": []interface{}{
+			map[string]interface{}{"type": "Available", "status": "True"},
+		},
+	}
+
+	status := feedbackToStatus(values)
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("expected %v, got %v", expected, status)
+	}
+}
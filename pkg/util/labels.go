@@ -33,6 +33,10 @@ const (
 	PlacementLabelKeyBase         = "managed-by.kubestellar.io"
 	PlacementLabelValueEnabled    = "true"
 	PlacementLabelSingletonStatus = "managed-by.kubestellar.io/singletonstatus"
+	// the name of the wds that owns a manifestwork, and the workstatus created for it.
+	// Used by controllers to select only the objects of their own wds when multiple wds
+	// share the same imbs.
+	WDSLabelKey = "kubestellar.io/wds"
 )
 
 func GetPlacementListerKey() string {
@@ -52,9 +56,20 @@ func SetManagedByPlacementLabels(obj metav1.Object, wdsName string, managedByPla
 	if singletonStatus {
 		objLabels[PlacementLabelSingletonStatus] = PlacementLabelValueEnabled
 	}
+	objLabels[WDSLabelKey] = wdsName
 	obj.SetLabels(objLabels)
 }
 
+// SelectorForWDS returns the label selector matching the objects owned by the given wds
+func SelectorForWDS(wdsName string) labels.Selector {
+	return labels.SelectorFromSet(labels.Set{WDSLabelKey: wdsName})
+}
+
+// IsOwnedByWDS returns true if the labels identify an object owned by the given wds
+func IsOwnedByWDS(objLabels map[string]string, wdsName string) bool {
+	return objLabels[WDSLabelKey] == wdsName
+}
+
 func mergeManagedByPlacementLabel(l labels.Set, wdsName, placementName string) labels.Set {
 	plLabel := make(labels.Set)
 	key := GenerateManagedByPlacementLabelKey(wdsName, placementName)
@@ -66,6 +81,32 @@ func GenerateManagedByPlacementLabelKey(wdsName, placementName string) string {
 	return fmt.Sprintf("%s/%s.%s", PlacementLabelKeyBase, wdsName, placementName)
 }
 
+// GetPlacementNamesFromLabels returns the names of the placements of the given WDS
+// found in the managed-by labels of an object owned by the WDS. The WDS label is checked
+// because the keys alone are ambiguous when names contain dots: WDS "a" with placement
+// "b.p" has the same key as WDS "a.b" with placement "p".
+func GetPlacementNamesFromLabels(objLabels map[string]string, wdsName string) []string {
+	if !IsOwnedByWDS(objLabels, wdsName) {
+		return []string{}
+	}
+	return GetLegacyPlacementNamesFromLabels(objLabels, wdsName)
+}
+
+// GetLegacyPlacementNamesFromLabels returns the names of the placements of the given WDS
+// found in the managed-by labels of an object, without checking the WDS label, which the
+// ManifestWorks created by earlier releases do not have. The names may belong to another
+// WDS whose name starts with the name of the given WDS followed by a dot.
+func GetLegacyPlacementNamesFromLabels(objLabels map[string]string, wdsName string) []string {
+	prefix := fmt.Sprintf("%s/%s.", PlacementLabelKeyBase, wdsName)
+	names := []string{}
+	for key := range objLabels {
+		if strings.HasPrefix(key, prefix) {
+			names = append(names, strings.TrimPrefix(key, prefix))
+		}
+	}
+	return names
+}
+
 func StringInSlice(str string, list []string) bool {
 	for _, v := range list {
 		if v == str {
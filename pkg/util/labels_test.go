@@ -0,0 +1,66 @@
+/*
+Copyright 2023 The KubeStellar Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"sort"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestGetPlacementNamesFromLabels(t *testing.T) {
+	// WDS "a" with placement "b.p" and WDS "a.b" with placement "p" have the same key
+	objLabels := map[string]string{
+		WDSLabelKey: "a.b",
+		GenerateManagedByPlacementLabelKey("a.b", "p"):  PlacementLabelValueEnabled,
+		GenerateManagedByPlacementLabelKey("a.b", "p2"): PlacementLabelValueEnabled,
+		PlacementLabelSingletonStatus:                   PlacementLabelValueEnabled,
+	}
+	names := GetPlacementNamesFromLabels(objLabels, "a.b")
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "p" || names[1] != "p2" {
+		t.Errorf("expected [p p2] for the owning WDS, got %v", names)
+	}
+	if names := GetPlacementNamesFromLabels(objLabels, "a"); len(names) != 0 {
+		t.Errorf("expected no placements for another WDS, got %v", names)
+	}
+
+	// without the WDS label the keys are ambiguous
+	delete(objLabels, WDSLabelKey)
+	if names := GetPlacementNamesFromLabels(objLabels, "a.b"); len(names) != 0 {
+		t.Errorf("expected no placements without the WDS label, got %v", names)
+	}
+	legacy := GetLegacyPlacementNamesFromLabels(objLabels, "a")
+	sort.Strings(legacy)
+	if len(legacy) != 2 || legacy[0] != "b.p" || legacy[1] != "b.p2" {
+		t.Errorf("expected the legacy names [b.p b.p2], got %v", legacy)
+	}
+}
+
+func TestSelectorForWDS(t *testing.T) {
+	obj := &metav1.ObjectMeta{}
+	SetManagedByPlacementLabels(obj, "wds1", []string{"p"}, false)
+	objLabels := obj.GetLabels()
+	if !SelectorForWDS("wds1").Matches(labels.Set(objLabels)) {
+		t.Errorf("expected the selector to match the labels set for the WDS")
+	}
+	if SelectorForWDS("wds2").Matches(labels.Set(objLabels)) {
+		t.Errorf("expected the selector of another WDS not to match")
+	}
+}
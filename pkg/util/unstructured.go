@@ -41,6 +41,10 @@ const (
 	WorkStatusVersion                    = "v1alpha1"
 	WorkStatusResource                   = "workstatuses"
 	AnnotationToPreserveValuesKey        = "annotations.kubestellar.io/preserve"
+	AnnotationDeletionPolicyKey          = "annotations.kubestellar.io/deletion-policy"
+	AnnotationUpdateStrategyKey          = "annotations.kubestellar.io/update-strategy"
+	AnnotationForceApplyKey              = "annotations.kubestellar.io/force-apply"
+	AnnotationFieldManagerKey            = "annotations.kubestellar.io/field-manager"
 	PreserveNodePortValue                = "nodeport"
 	UnableToRetrieveCompleteAPIListError = "unable to retrieve the complete list of server APIs"
 )